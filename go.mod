@@ -4,8 +4,11 @@ go 1.18
 
 require (
 	github.com/gin-gonic/gin v1.10.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/sugarshop/env v1.0.1
 	github.com/tj/assert v0.0.3
+	go.etcd.io/bbolt v1.3.9
+	golang.org/x/crypto v0.23.0
 )
 
 require (
@@ -35,7 +38,6 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	golang.org/x/arch v0.8.0 // indirect
-	golang.org/x/crypto v0.23.0 // indirect
 	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
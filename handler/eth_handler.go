@@ -1,27 +1,57 @@
 package handler
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/sugarshop/token-gateway/model"
 	"github.com/sugarshop/token-gateway/service"
 	"github.com/sugarshop/token-gateway/util"
+	"io"
 	"log"
+	"math/big"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type ETHHandler struct {
-
+	pushPingInterval time.Duration // how often the push socket is pinged.
+	pushPongTimeout  time.Duration // a push socket silent for this long, not even a pong, is closed.
+	pushWriteTimeout time.Duration // a push socket write blocked for this long closes it.
+	pushReadLimit    int64         // largest request accepted on the push socket, in bytes.
 }
 
 // NewETHHandler return ETH handler
 func NewETHHandler() *ETHHandler {
-	return &ETHHandler{}
+	return &ETHHandler{
+		pushPingInterval: util.EnvDuration("PUSH_PING_INTERVAL", 30*time.Second),
+		pushPongTimeout:  util.EnvDuration("PUSH_PONG_TIMEOUT", 60*time.Second),
+		pushWriteTimeout: util.EnvDuration("PUSH_WRITE_TIMEOUT", 10*time.Second),
+		pushReadLimit:    util.EnvInt64("PUSH_READ_LIMIT", 64*1024),
+	}
 }
 
 func (eth *ETHHandler) Register(e *gin.Engine) {
 	e.GET("/v1/get_current_block", JSONWrapper(eth.GetCurrentBlock))
 	e.POST("/v1/subscribe", JSONWrapper(eth.Subscribe))
+	e.POST("/v1/bulk_subscribe", JSONWrapper(eth.BulkSubscribe))
+	e.POST("/v1/unsubscribe", JSONWrapper(eth.Unsubscribe))
+	e.GET("/v1/get_subscription", JSONWrapper(eth.GetSubscription))
+	e.GET("/v1/list_subscriptions", JSONWrapper(eth.ListSubscriptions))
 	e.GET("/v1/get_transactions", JSONWrapper(eth.GetTransactions))
+	e.GET("/v1/stream_transactions", JSONWrapper(eth.StreamTransactions))
+	e.GET("/v1/push", JSONWrapper(eth.PushSocket))
+	e.GET("/v1/get_token_transfers", JSONWrapper(eth.GetTokenTransfers))
+	e.GET("/v1/get_nft_transfers", JSONWrapper(eth.GetNFTTransfers))
+	e.GET("/v1/get_internal_transfers", JSONWrapper(eth.GetInternalTransfers))
+	e.GET("/v1/get_withdrawals", JSONWrapper(eth.GetWithdrawals))
+	e.GET("/v1/get_reorgs", JSONWrapper(eth.GetReorgs))
+	e.GET("/v1/get_backfill_job", JSONWrapper(eth.GetBackfillJob))
+	e.GET("/v1/list_backfill_jobs", JSONWrapper(eth.ListBackfillJobs))
+	e.GET("/v1/health", JSONWrapper(eth.Health))
 }
 
 // GetCurrentBlock get last parsed block.
@@ -35,35 +65,474 @@ func (eth *ETHHandler) GetCurrentBlock(c *gin.Context) (interface{}, error) {
 	return blockInfo, nil
 }
 
-// Subscribe subscribe address to server.
+// Subscribe subscribe address to server, with optional label and owner.
+// optional from_block (decimal or 0x hex) start a backfill job of the address history from that block.
 func (eth *ETHHandler) Subscribe(c *gin.Context) (interface{}, error) {
 	ctx := util.RPCContext(c)
-	address := c.Request.Form.Get("address")
-	if len(address) == 0 {
-		log.Println(ctx, "[Subscribe]: parse address param err")
-		return nil, errors.New("parse address param err")
+	address, err := parseAddress(c, "address", true)
+	if err != nil {
+		log.Println(ctx, "[Subscribe]: parseAddress err: ", err)
+		return nil, err
+	}
+	fromBlock := int64(-1)
+	if fromBlockStr := c.Request.Form.Get("from_block"); len(fromBlockStr) > 0 {
+		num, err := strconv.ParseInt(fromBlockStr, 0, 64)
+		if err != nil || num < 0 {
+			log.Println(ctx, "[Subscribe]: parse from_block param err: ", err)
+			return nil, errors.New("parse from_block param err")
+		}
+		fromBlock = num
+	}
+	job, err := service.ETHServiceInstance().SubscribeFrom(ctx, &model.ETHSubscribeRequest{
+		Address:   address,
+		FromBlock: fromBlock,
+		Label:     c.Request.Form.Get("label"),
+		Owner:     c.Request.Form.Get("owner"),
+	})
+	if err != nil {
+		log.Println(ctx, "[Subscribe]: SubscribeFrom err: ", err)
+		return nil, err
+	}
+	if job != nil {
+		return map[string]interface{}{
+			"backfill": job,
+		}, nil
+	}
+	return map[string]interface{}{}, nil
+}
+
+// BulkSubscribe subscribe many addresses, given as a JSON array of {"address", "label", "owner"} objects
+// or as an uploaded CSV file of address,label,owner rows with an optional header.
+// label and owner params apply to rows without their own, each address is reported as subscribed or failed.
+func (eth *ETHHandler) BulkSubscribe(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	var reqs []*model.ETHSubscribeRequest
+	var err error
+	// rows are read one by one and reading stops past the limit, an oversized import is never decoded in full.
+	limit := service.ETHServiceInstance().BulkSubscribeLimit()
+	if c.ContentType() == gin.MIMEJSON {
+		reqs, err = parseSubscribeJSON(c.Request.Body, limit)
+	} else {
+		reqs, err = parseSubscribeCSV(c, limit)
+	}
+	if err != nil {
+		log.Println(ctx, "[BulkSubscribe]: parse addresses err: ", err)
+		return nil, fmt.Errorf("parse addresses err: %w", err)
+	}
+	label, owner := c.Request.Form.Get("label"), c.Request.Form.Get("owner")
+	for _, req := range reqs {
+		if req == nil {
+			log.Println(ctx, "[BulkSubscribe]: parse addresses err: null row")
+			return nil, errors.New("parse addresses err: null row")
+		}
+		if len(req.Label) == 0 {
+			req.Label = label
+		}
+		if len(req.Owner) == 0 {
+			req.Owner = owner
+		}
+	}
+	result, err := service.ETHServiceInstance().BulkSubscribe(ctx, reqs)
+	if err != nil {
+		log.Println(ctx, "[BulkSubscribe]: BulkSubscribe err: ", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseSubscribeJSON read the JSON array of subscribe requests of body, at most limit of them.
+func parseSubscribeJSON(body io.Reader, limit int) ([]*model.ETHSubscribeRequest, error) {
+	decoder := json.NewDecoder(body)
+	if token, err := decoder.Token(); err != nil {
+		return nil, err
+	} else if token != json.Delim('[') {
+		return nil, errors.New("expected a JSON array")
+	}
+	reqs := make([]*model.ETHSubscribeRequest, 0)
+	for decoder.More() {
+		if len(reqs) == limit {
+			return nil, fmt.Errorf("more addresses than the bulk subscribe limit %d", limit)
+		}
+		var req *model.ETHSubscribeRequest
+		if err := decoder.Decode(&req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	// the closing bracket.
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+// parseSubscribeCSV read address,label,owner rows of the uploaded file param, at most limit of them,
+// label and owner may be left out.
+func parseSubscribeCSV(c *gin.Context, limit int) ([]*model.ETHSubscribeRequest, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reqs := make([]*model.ETHSubscribeRequest, 0)
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "address") {
+			continue
+		}
+		if len(reqs) == limit {
+			return nil, fmt.Errorf("more addresses than the bulk subscribe limit %d", limit)
+		}
+		req := &model.ETHSubscribeRequest{Address: record[0]}
+		if len(record) > 1 {
+			req.Label = record[1]
+		}
+		if len(record) > 2 {
+			req.Owner = record[2]
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// Unsubscribe stop tracking address, its stored history is kept unless purge param is true.
+func (eth *ETHHandler) Unsubscribe(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	address, err := parseAddress(c, "address", true)
+	if err != nil {
+		log.Println(ctx, "[Unsubscribe]: parseAddress err: ", err)
+		return nil, err
 	}
-	if err := service.ETHServiceInstance().Subscribe(ctx, strings.ToLower(address)); err != nil {
-		log.Println(ctx, "[Subscribe]: Subscribe err: ", err)
+	purge := false
+	if purgeStr := c.Request.Form.Get("purge"); len(purgeStr) > 0 {
+		if purge, err = strconv.ParseBool(purgeStr); err != nil {
+			log.Println(ctx, "[Unsubscribe]: parse purge param err: ", err)
+			return nil, errors.New("parse purge param err")
+		}
+	}
+	if err := service.ETHServiceInstance().Unsubscribe(ctx, address, purge); err != nil {
+		log.Println(ctx, "[Unsubscribe]: Unsubscribe err: ", err)
 		return nil, err
 	}
 	return map[string]interface{}{}, nil
 }
 
-// GetTransactions list of inbound or outbound transactions for an address.
+// GetSubscription subscription of an address: created time, start block, label and owner.
+func (eth *ETHHandler) GetSubscription(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	address, err := parseAddress(c, "address", true)
+	if err != nil {
+		log.Println(ctx, "[GetSubscription]: parseAddress err: ", err)
+		return nil, err
+	}
+	sub, err := service.ETHServiceInstance().GetSubscription(ctx, address)
+	if err != nil {
+		log.Println(ctx, "[GetSubscription]: GetSubscription err: ", err)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSubscriptions page of subscriptions ordered by address, of one owner if owner param is set,
+// limit and cursor params page through them like GetTransactions.
+func (eth *ETHHandler) ListSubscriptions(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	limit := 0
+	if limitStr := c.Request.Form.Get("limit"); len(limitStr) > 0 {
+		num, err := strconv.Atoi(limitStr)
+		if err != nil || num <= 0 {
+			log.Println(ctx, "[ListSubscriptions]: parse limit param err: ", err)
+			return nil, errors.New("parse limit param err")
+		}
+		limit = num
+	}
+	page, err := service.ETHServiceInstance().ListSubscriptions(ctx, c.Request.Form.Get("owner"), c.Request.Form.Get("cursor"), limit)
+	if err != nil {
+		log.Println(ctx, "[ListSubscriptions]: ListSubscriptions err: ", err)
+		return nil, err
+	}
+	return page, nil
+}
+
+// GetTransactions page of inbound or outbound transactions for an address, see parseTxQuery for the params.
 func (eth *ETHHandler) GetTransactions(c *gin.Context) (interface{}, error) {
 	ctx := util.RPCContext(c)
-	address := c.Request.Form.Get("address")
+	address, err := parseAddress(c, "address", true)
+	if err != nil {
+		log.Println(ctx, "[GetTransactions]: parseAddress err: ", err)
+		return nil, err
+	}
+	query, err := parseTxQuery(c)
+	if err != nil {
+		log.Println(ctx, "[GetTransactions]: parseTxQuery err: ", err)
+		return nil, err
+	}
+	page, err := service.ETHServiceInstance().QueryTransactions(ctx, address, query)
+	if err != nil {
+		log.Println(ctx, "[GetTransactions]: QueryTransactions err: ", err)
+		return nil, err
+	}
+	return page, nil
+}
+
+// StreamTransactions stream transactions of the address params as server-sent events as blocks are parsed,
+// address is repeated or comma separated. a client reconnecting with the Last-Event-ID header
+// (or the last_event_id param) first receives the stored transactions after that event.
+// errors before the stream opens are returned as JSON.
+func (eth *ETHHandler) StreamTransactions(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	addresses, err := parseAddresses(c, "address")
+	if err != nil {
+		log.Println(ctx, "[StreamTransactions]: parseAddresses err: ", err)
+		return nil, err
+	}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if len(lastEventID) == 0 {
+		lastEventID = c.Request.Form.Get("last_event_id")
+	}
+	format := c.Request.Form.Get("format")
+	err = service.ETHServiceInstance().StreamTransactions(ctx, addresses, lastEventID, func(event *model.ETHTxEvent) error {
+		return writeSSE(c, event, format)
+	})
+	if err != nil {
+		log.Println(ctx, "[StreamTransactions]: StreamTransactions err: ", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// parseAddresses read the addresses of a repeated or comma separated param name, at least one is required.
+func parseAddresses(c *gin.Context, name string) ([]string, error) {
+	addresses := make([]string, 0)
+	for _, value := range c.Request.Form[name] {
+		for _, address := range strings.Split(value, ",") {
+			address, err := util.ParseAddress(strings.TrimSpace(address))
+			if err != nil {
+				return nil, fmt.Errorf("parse %s param err: %w", name, err)
+			}
+			addresses = append(addresses, address)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("parse %s param err", name)
+	}
+	return addresses, nil
+}
+
+// parseAddress read the address param name lowercased, empty if not set and not required,
+// a mixed-case address must carry a valid EIP-55 checksum.
+func parseAddress(c *gin.Context, name string, required bool) (string, error) {
+	address := c.Request.Form.Get(name)
 	if len(address) == 0 {
-		log.Println(ctx, "[GetTransactions]: parse address param err")
-		return nil, errors.New("parse address param err")
+		if required {
+			return "", fmt.Errorf("parse %s param err", name)
+		}
+		return "", nil
+	}
+	address, err := util.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("parse %s param err: %w", name, err)
+	}
+	return address, nil
+}
+
+// parseTxQuery parse page and filter params of a transaction listing,
+// block numbers, timestamps and min_value (wei) are decimal or 0x hex, type is a name or a number.
+func parseTxQuery(c *gin.Context) (*model.ETHTxQuery, error) {
+	form := c.Request.Form
+	query := &model.ETHTxQuery{
+		Cursor:    form.Get("cursor"),
+		Order:     form.Get("order"),
+		Direction: form.Get("direction"),
+	}
+	if limitStr := form.Get("limit"); len(limitStr) > 0 {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return nil, errors.New("parse limit param err")
+		}
+		query.Limit = limit
+	}
+	for name, dest := range map[string]*uint64{
+		"from_block": &query.FromBlock,
+		"to_block":   &query.ToBlock,
+		"from_time":  &query.FromTime,
+		"to_time":    &query.ToTime,
+	} {
+		if str := form.Get(name); len(str) > 0 {
+			num, err := strconv.ParseUint(str, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s param err", name)
+			}
+			*dest = num
+		}
+	}
+	if minValueStr := form.Get("min_value"); len(minValueStr) > 0 {
+		minValue, ok := new(big.Int).SetString(minValueStr, 0)
+		if !ok || minValue.Sign() < 0 {
+			return nil, errors.New("parse min_value param err")
+		}
+		query.MinValue = minValue
+	}
+	if typeStr := form.Get("type"); len(typeStr) > 0 {
+		txType, err := model.ParseTxType(typeStr)
+		if err != nil {
+			return nil, err
+		}
+		query.Type = &txType
+	}
+	return query, nil
+}
+
+// GetTokenTransfers list of inbound or outbound ERC-20 transfers for an address, of one token contract if token param is set.
+func (eth *ETHHandler) GetTokenTransfers(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	address, err := parseAddress(c, "address", true)
+	if err != nil {
+		log.Println(ctx, "[GetTokenTransfers]: parseAddress err: ", err)
+		return nil, err
+	}
+	token, err := parseAddress(c, "token", false)
+	if err != nil {
+		log.Println(ctx, "[GetTokenTransfers]: parseAddress err: ", err)
+		return nil, err
+	}
+	transfers, err := service.ETHServiceInstance().GetTokenTransfers(ctx, address, token)
+	if err != nil {
+		log.Println(ctx, "[GetTokenTransfers]: GetTokenTransfers err: ", err)
+		return nil, err
+	}
+	return map[string]interface{} {
+		"transfers": transfers,
+	}, nil
+}
+
+// GetNFTTransfers list of ERC-721 and ERC-1155 deposits and withdrawals for an address,
+// of one token contract if token param is set.
+func (eth *ETHHandler) GetNFTTransfers(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	address, err := parseAddress(c, "address", true)
+	if err != nil {
+		log.Println(ctx, "[GetNFTTransfers]: parseAddress err: ", err)
+		return nil, err
+	}
+	token, err := parseAddress(c, "token", false)
+	if err != nil {
+		log.Println(ctx, "[GetNFTTransfers]: parseAddress err: ", err)
+		return nil, err
+	}
+	transfers, err := service.ETHServiceInstance().GetNFTTransfers(ctx, address, token)
+	if err != nil {
+		log.Println(ctx, "[GetNFTTransfers]: GetNFTTransfers err: ", err)
+		return nil, err
+	}
+	return map[string]interface{} {
+		"transfers": transfers,
+	}, nil
+}
+
+// GetInternalTransfers list of ether moved from or to an address by internal calls, linked to their parent transaction.
+func (eth *ETHHandler) GetInternalTransfers(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	address, err := parseAddress(c, "address", true)
+	if err != nil {
+		log.Println(ctx, "[GetInternalTransfers]: parseAddress err: ", err)
+		return nil, err
+	}
+	transfers, err := service.ETHServiceInstance().GetInternalTransfers(ctx, address)
+	if err != nil {
+		log.Println(ctx, "[GetInternalTransfers]: GetInternalTransfers err: ", err)
+		return nil, err
 	}
-	transactions, err := service.ETHServiceInstance().GetTransactions(ctx, strings.ToLower(address))
+	return map[string]interface{} {
+		"transfers": transfers,
+	}, nil
+}
+
+// GetReorgs list of recent chain reorganizations, transactions of orphaned blocks have been rolled back.
+func (eth *ETHHandler) GetReorgs(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	reorgs, err := service.ETHServiceInstance().GetReorgs(ctx)
 	if err != nil {
-		log.Println(ctx, "[GetTransactions]: GetTransactions err: ", err)
+		log.Println(ctx, "[GetReorgs]: GetReorgs err: ", err)
 		return nil, err
 	}
 	return map[string]interface{} {
-		"transactions": transactions,
+		"reorgs": reorgs,
 	}, nil
-}
\ No newline at end of file
+}
+
+// GetBackfillJob status of a backfill job: progress, ETA and error.
+func (eth *ETHHandler) GetBackfillJob(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	id := c.Request.Form.Get("id")
+	if len(id) == 0 {
+		log.Println(ctx, "[GetBackfillJob]: parse id param err")
+		return nil, errors.New("parse id param err")
+	}
+	job, err := service.ETHServiceInstance().GetBackfillJob(ctx, id)
+	if err != nil {
+		log.Println(ctx, "[GetBackfillJob]: GetBackfillJob err: ", err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// ListBackfillJobs list backfill jobs, of one address if address param is set.
+func (eth *ETHHandler) ListBackfillJobs(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	address, err := parseAddress(c, "address", false)
+	if err != nil {
+		log.Println(ctx, "[ListBackfillJobs]: parseAddress err: ", err)
+		return nil, err
+	}
+	jobs, err := service.ETHServiceInstance().ListBackfillJobs(ctx, address)
+	if err != nil {
+		log.Println(ctx, "[ListBackfillJobs]: ListBackfillJobs err: ", err)
+		return nil, err
+	}
+	return map[string]interface{} {
+		"jobs": jobs,
+	}, nil
+}
+
+// Health upstream circuit breaker state and ingest progress.
+func (eth *ETHHandler) Health(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	health, err := service.ETHServiceInstance().Health(ctx)
+	if err != nil {
+		log.Println(ctx, "[Health]: Health err: ", err)
+		return nil, err
+	}
+	return health, nil
+}
+
+// GetWithdrawals list of beacon chain withdrawals credited to an address, amounts in wei.
+func (eth *ETHHandler) GetWithdrawals(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	address, err := parseAddress(c, "address", true)
+	if err != nil {
+		log.Println(ctx, "[GetWithdrawals]: parseAddress err: ", err)
+		return nil, err
+	}
+	withdrawals, err := service.ETHServiceInstance().GetWithdrawals(ctx, address)
+	if err != nil {
+		log.Println(ctx, "[GetWithdrawals]: GetWithdrawals err: ", err)
+		return nil, err
+	}
+	return map[string]interface{} {
+		"withdrawals": withdrawals,
+	}, nil
+}
@@ -1,16 +1,28 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/remote"
+	"github.com/sugarshop/token-gateway/util"
 	"net/http"
 )
 
 // JSONWrapper Encapsulate the data processing function as a JSON API return;
 // pay attention to using PureJSON to avoid Gin performing HTML escaping during serialization of data.
+// quantities are rendered as hex unless the format param asks for model.FORMAT_DECIMAL or model.FORMAT_ETH.
 func JSONWrapper(fn func(*gin.Context) (interface{}, error)) func(*gin.Context) {
 	return func(c *gin.Context) {
-		data, err := fn(c)
+		format := c.Request.Form.Get("format")
+		var data interface{}
+		err := model.CheckFormat(format)
+		if err == nil {
+			data, err = fn(c)
+		}
+		if err == nil {
+			data, err = model.Format(data, format)
+		}
 
 		// if write is been writen at here, do not write again or you will get panic
 		if c.Writer.Written() {
@@ -20,7 +32,7 @@ func JSONWrapper(fn func(*gin.Context) (interface{}, error)) func(*gin.Context)
 		if err != nil {
 			//c.Set(tracing.CtxRespCodeKey, base.FAILED)
 			c.PureJSON(http.StatusOK, &ErrResp{
-				Code:   model.RESPONSE_FAILD,
+				Code:   errorCode(err),
 				Msg:    err.Error(),
 				Detail: err.Error(),
 			})
@@ -34,6 +46,30 @@ func JSONWrapper(fn func(*gin.Context) (interface{}, error)) func(*gin.Context)
 	}
 }
 
+// errorCode map an error to the API error code, typed upstream errors get their own code.
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, remote.ErrRateLimited):
+		return model.RESPONSE_UPSTREAM_RATE_LIMITED
+	case errors.Is(err, remote.ErrMethodNotFound):
+		return model.RESPONSE_UPSTREAM_METHOD_NOT_FOUND
+	case errors.Is(err, remote.ErrInvalidParams):
+		return model.RESPONSE_UPSTREAM_INVALID_PARAMS
+	case errors.Is(err, remote.ErrHeaderNotFound):
+		return model.RESPONSE_UPSTREAM_HEADER_NOT_FOUND
+	case errors.Is(err, remote.ErrUpstreamTimeout):
+		return model.RESPONSE_UPSTREAM_TIMEOUT
+	case errors.Is(err, remote.ErrUpstreamUnavailable), errors.Is(err, remote.ErrCircuitOpen):
+		return model.RESPONSE_UPSTREAM_UNAVAILABLE
+	case errors.Is(err, util.ErrInvalidAddress):
+		return model.RESPONSE_INVALID_ADDRESS
+	case errors.Is(err, util.ErrAddressChecksum):
+		return model.RESPONSE_INVALID_ADDRESS_CHECKSUM
+	default:
+		return model.RESPONSE_FAILD
+	}
+}
+
 type ErrResp struct {
 	Code   int    `json:"code"`
 	Msg    string `json:"msg"`
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/service"
+	"github.com/sugarshop/token-gateway/util"
+)
+
+var pushUpgrader = websocket.Upgrader{}
+
+// PushSocket upgrade to a websocket where the client subscribes and unsubscribes topics with model.ETHPushRequest
+// messages, and receives replies and pushed events as model.ETHPushMessage with quantities in the format param.
+// the socket is pinged every PUSH_PING_INTERVAL, a silent client or one too slow to keep up with pushes is disconnected.
+// errors before the upgrade are returned as JSON.
+func (eth *ETHHandler) PushSocket(c *gin.Context) (interface{}, error) {
+	ctx := util.RPCContext(c)
+	conn, err := service.ETHServiceInstance().OpenPush(ctx)
+	if err != nil {
+		log.Println(ctx, "[PushSocket]: OpenPush err: ", err)
+		return nil, err
+	}
+	defer service.ETHServiceInstance().ClosePush(conn)
+	ws, err := pushUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader already replied with an HTTP error.
+		log.Println(ctx, "[PushSocket]: Upgrade err: ", err)
+		return nil, nil
+	}
+	defer ws.Close()
+	format := c.Request.Form.Get("format")
+	replies := make(chan *model.ETHPushMessage)
+	quit := make(chan struct{})
+	defer close(quit)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- eth.readPush(ctx, ws, conn, replies, quit)
+	}()
+	ping := time.NewTicker(eth.pushPingInterval)
+	defer ping.Stop()
+	for {
+		var msg *model.ETHPushMessage
+		select {
+		case err := <-readErr:
+			log.Println(ctx, "[PushSocket]: read err: ", err)
+			return nil, nil
+		case msg = <-replies:
+		case event, ok := <-conn.Events():
+			if !ok {
+				log.Println(ctx, "[PushSocket]: client fell behind, topics:", len(conn.Topics()))
+				closing := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow to keep up with pushes")
+				ws.WriteControl(websocket.CloseMessage, closing, time.Now().Add(eth.pushWriteTimeout))
+				return nil, nil
+			}
+			msg = event
+		case <-ping.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(eth.pushWriteTimeout)); err != nil {
+				log.Println(ctx, "[PushSocket]: ping err: ", err)
+				return nil, nil
+			}
+			continue
+		}
+		data, err := model.Format(msg, format)
+		if err != nil {
+			log.Println(ctx, "[PushSocket]: Format err: ", err)
+			return nil, nil
+		}
+		ws.SetWriteDeadline(time.Now().Add(eth.pushWriteTimeout))
+		if err := ws.WriteJSON(data); err != nil {
+			log.Println(ctx, "[PushSocket]: write err: ", err)
+			return nil, nil
+		}
+	}
+}
+
+// readPush apply requests read from the push socket until reading fails, each one is answered through replies.
+func (eth *ETHHandler) readPush(ctx context.Context, ws *websocket.Conn, conn *service.PushConn, replies chan<- *model.ETHPushMessage, quit <-chan struct{}) error {
+	ws.SetReadLimit(eth.pushReadLimit)
+	ws.SetReadDeadline(time.Now().Add(eth.pushPongTimeout))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(eth.pushPongTimeout))
+	})
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		ws.SetReadDeadline(time.Now().Add(eth.pushPongTimeout))
+		req := &model.ETHPushRequest{}
+		reply := &model.ETHPushMessage{}
+		if err := json.Unmarshal(data, req); err != nil {
+			reply.Error = fmt.Sprintf("parse request err: %v", err)
+		} else {
+			reply.ID = &req.ID
+			switch req.Method {
+			case model.PUSH_METHOD_SUBSCRIBE:
+				err = service.ETHServiceInstance().PushSubscribe(ctx, conn, req.Topics)
+			case model.PUSH_METHOD_UNSUBSCRIBE:
+				err = service.ETHServiceInstance().PushUnsubscribe(ctx, conn, req.Topics)
+			default:
+				err = fmt.Errorf("unknown method %q", req.Method)
+			}
+			if err != nil {
+				log.Println(ctx, "[readPush]: request err: ", err)
+				reply.Error = err.Error()
+			}
+		}
+		reply.Topics = conn.Topics()
+		select {
+		case replies <- reply:
+		case <-quit:
+			return nil
+		}
+	}
+}
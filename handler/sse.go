@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// writeSSE write event as a server-sent event with quantities in format, a nil event is a keep-alive comment.
+// the stream headers are written with the first event.
+func writeSSE(c *gin.Context, event *model.ETHTxEvent, format string) error {
+	if !c.Writer.Written() {
+		header := c.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		// keep proxies such as nginx from buffering the stream.
+		header.Set("X-Accel-Buffering", "no")
+		c.Writer.WriteHeader(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+	}
+	var err error
+	if event == nil {
+		_, err = fmt.Fprint(c.Writer, ": ping\n\n")
+	} else {
+		var data interface{}
+		if data, err = model.Format(event, format); err != nil {
+			return err
+		}
+		var body []byte
+		if body, err = json.Marshal(data); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: transaction\ndata: %s\n\n", event.ID, body)
+	}
+	if err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
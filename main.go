@@ -51,6 +51,8 @@ func main() {
 	// kill -9 is syscall.SIGKILL but can't be catch, so don't need add it
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	// flush and close the storage, so the bolt file is not left locked mid write.
+	service.Close()
 }
 
 func Init()  {
@@ -3,4 +3,16 @@ package model
 const (
 	RESPONSE_OK = 0
 	RESPONSE_FAILD = -1
+
+	// upstream JSON-RPC node failures.
+	RESPONSE_UPSTREAM_RATE_LIMITED     = -1001
+	RESPONSE_UPSTREAM_METHOD_NOT_FOUND = -1002
+	RESPONSE_UPSTREAM_INVALID_PARAMS   = -1003
+	RESPONSE_UPSTREAM_HEADER_NOT_FOUND = -1004
+	RESPONSE_UPSTREAM_TIMEOUT          = -1005
+	RESPONSE_UPSTREAM_UNAVAILABLE      = -1006
+
+	// request validation failures.
+	RESPONSE_INVALID_ADDRESS          = -2001
+	RESPONSE_INVALID_ADDRESS_CHECKSUM = -2002
 )
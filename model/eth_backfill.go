@@ -0,0 +1,26 @@
+package model
+
+// backfill job status.
+const (
+	BACKFILL_STATUS_RUNNING   = "running"
+	BACKFILL_STATUS_COMPLETED = "completed"
+	BACKFILL_STATUS_FAILED    = "failed"
+)
+
+// ETHBackfillJob scan historical blocks for a newly subscribed address.
+type ETHBackfillJob struct {
+	ID           string  `json:"id"`
+	Address      Address `json:"address"`
+	FromBlock    int64   `json:"fromBlock"`
+	ToBlock      int64   `json:"toBlock"`
+	CurrentBlock int64   `json:"currentBlock"` // last scanned block, FromBlock-1 before the first one.
+	Status       string  `json:"status"`
+	Progress     float64 `json:"progress"`   // scanned blocks ratio, from 0 to 1.
+	ETASeconds   int64   `json:"etaSeconds"` // estimated seconds left, 0 if unknown or done.
+	Transactions int64   `json:"transactions"`
+	Transfers    int64   `json:"transfers"` // token and internal transfers and withdrawals.
+	Error        string  `json:"error"`
+	CreatedAt    int64   `json:"createdAt"` // unix seconds.
+	UpdatedAt    int64   `json:"updatedAt"`
+	FinishedAt   int64   `json:"finishedAt"`
+}
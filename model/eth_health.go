@@ -0,0 +1,54 @@
+package model
+
+// health status.
+const (
+	HEALTH_STATUS_OK       = "ok"
+	HEALTH_STATUS_DEGRADED = "degraded" // some upstream endpoint is unhealthy.
+	HEALTH_STATUS_DOWN     = "down"     // no upstream endpoint is healthy.
+)
+
+// CircuitBreakerState snapshot of an upstream circuit breaker.
+type CircuitBreakerState struct {
+	State               string `json:"state"` // closed, open or half_open.
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	OpenedAt            int64  `json:"openedAt"` // unix seconds, 0 if closed.
+	LastError           string `json:"lastError"`
+}
+
+// RPCEndpointStats stats of one upstream JSON-RPC endpoint.
+type RPCEndpointStats struct {
+	Name         string               `json:"name"` // scheme and host, the rest of the url may carry an api key.
+	Priority     int                  `json:"priority"`
+	Weight       int                  `json:"weight"`
+	Head         int64                `json:"head"`    // head seen by the last health check.
+	Lag          int64                `json:"lag"`     // blocks behind the best endpoint.
+	Lagging      bool                 `json:"lagging"` // avoided while another endpoint is healthy.
+	Requests     int64                `json:"requests"`
+	Failures     int64                `json:"failures"`
+	AvgLatencyMs int64                `json:"avgLatencyMs"`
+	LastError    string               `json:"lastError"`
+	LastCheckAt  int64                `json:"lastCheckAt"` // unix seconds.
+	Breaker      *CircuitBreakerState `json:"breaker"`
+}
+
+// RPCHealth health of the upstream JSON-RPC endpoints.
+type RPCHealth struct {
+	Healthy   int                 `json:"healthy"` // endpoints with a closed breaker and not lagging.
+	Endpoints []*RPCEndpointStats `json:"endpoints"`
+}
+
+// IngestHealth progress of the ingest loop.
+type IngestHealth struct {
+	HeadBlock      int64  `json:"headBlock"`
+	ParsedBlock    int64  `json:"parsedBlock"`
+	FinalizedBlock int64  `json:"finalizedBlock"`
+	Lag            int64  `json:"lag"`       // blocks behind the head.
+	Transport      string `json:"transport"` // poll or ws, poll while the WebSocket is down.
+}
+
+// Health health output of the service.
+type Health struct {
+	Status string        `json:"status"` // HEALTH_STATUS_*.
+	RPC    *RPCHealth    `json:"rpc"`
+	Ingest *IngestHealth `json:"ingest"`
+}
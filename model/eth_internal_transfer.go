@@ -0,0 +1,73 @@
+package model
+
+// trace modes of the internal transfer parser.
+const (
+	TRACE_MODE_OFF    = ""       // internal transfers are not parsed.
+	TRACE_MODE_DEBUG  = "debug"  // debug_traceBlockByHash with callTracer, geth and erigon.
+	TRACE_MODE_PARITY = "parity" // trace_block, erigon, nethermind and reth.
+)
+
+// ETHInternalTransfer ether moved by a call inside a transaction, invisible in the transaction list of a block.
+type ETHInternalTransfer struct {
+	TransactionHash  Hash    `json:"transactionHash"` // the parent transaction.
+	TransactionIndex Uint64  `json:"transactionIndex"`
+	BlockNumber      Uint64  `json:"blockNumber"`
+	BlockHash        Hash    `json:"blockHash"`
+	From             Address `json:"from"`
+	To               Address `json:"to"`
+	Value            *Wei    `json:"value"`
+	CallType         string  `json:"callType"`     // call, create, create2 or selfdestruct.
+	TraceAddress     []int   `json:"traceAddress"` // path of the call in the call tree of the transaction.
+}
+
+// ETHCallFrame call tree of a transaction returned by the callTracer.
+type ETHCallFrame struct {
+	Type    string          `json:"type"` // CALL, STATICCALL, DELEGATECALL, CALLCODE, CREATE, CREATE2 or SELFDESTRUCT.
+	From    string          `json:"from"`
+	To      string          `json:"to"`
+	Value   string          `json:"value"`
+	Gas     string          `json:"gas"`
+	GasUsed string          `json:"gasUsed"`
+	Input   string          `json:"input"`
+	Output  string          `json:"output"`
+	Error   string          `json:"error"` // reverted, with every nested call.
+	Calls   []*ETHCallFrame `json:"calls"`
+}
+
+// ETHTxCallTrace callTracer result of one transaction of debug_traceBlockByHash.
+type ETHTxCallTrace struct {
+	TxHash string        `json:"txHash"` // missing on older nodes, use the transaction position instead.
+	Result *ETHCallFrame `json:"result"`
+}
+
+// ETHParityTrace one flattened call of trace_block.
+type ETHParityTrace struct {
+	Action              *ETHParityTraceAction `json:"action"`
+	BlockHash           string                `json:"blockHash"`
+	BlockNumber         int64                 `json:"blockNumber"`
+	Error               string                `json:"error"`
+	Result              *ETHParityTraceResult `json:"result"`
+	Subtraces           int                   `json:"subtraces"`
+	TraceAddress        []int                 `json:"traceAddress"`
+	TransactionHash     string                `json:"transactionHash"`
+	TransactionPosition int                   `json:"transactionPosition"`
+	Type                string                `json:"type"` // call, create, suicide or reward.
+}
+
+// ETHParityTraceAction action of a trace_block call, fields depend on the trace type.
+type ETHParityTraceAction struct {
+	CallType      string `json:"callType"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Value         string `json:"value"`
+	Address       string `json:"address"`       // suicide: the destroyed contract.
+	RefundAddress string `json:"refundAddress"` // suicide: the beneficiary.
+	Balance       string `json:"balance"`       // suicide: the amount sent to the beneficiary.
+}
+
+// ETHParityTraceResult result of a trace_block call, nil if it reverted.
+type ETHParityTraceResult struct {
+	Address string `json:"address"` // create: the created contract.
+	GasUsed string `json:"gasUsed"`
+	Output  string `json:"output"`
+}
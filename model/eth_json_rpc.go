@@ -1,5 +1,7 @@
 package model
 
+import "encoding/json"
+
 // JSONRPCRequest represents the structure of the JSON-RPC request
 type JSONRPCRequest struct {
 	JSONRPC string        `json:"jsonrpc"`
@@ -8,76 +10,118 @@ type JSONRPCRequest struct {
 	ID      int           `json:"id"`
 }
 
-// ETHBlockNumberResponse response of the ethBlockNumber request
-type ETHBlockNumberResponse struct {
-	JSONRPC string `json:"jsonrpc"`
-	ID      int    `json:"id"`
-	Result  string `json:"result"`
+// JSONRPCResponse generic JSON-RPC response, Result is decoded by the caller once ID is matched.
+type JSONRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *JSONRPCError   `json:"error"`
 }
 
-// ETHGetBlockByNumberResponse response of the eth_getBlockByNumber request
-type ETHGetBlockByNumberResponse struct {
-	JSONRPC string `json:"jsonrpc"`
-	ID      int    `json:"id"`
-	Result  *ETHBlockInfo `json:"result"`
+// JSONRPCError error object of a JSON-RPC response.
+type JSONRPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
 }
 
+// ETHTransaction transaction object of a block, quantities are decoded from hex.
 type ETHTransaction struct {
-	BlockHash            string   `json:"blockHash"`
-	BlockNumber          string   `json:"blockNumber"`
-	From                 string   `json:"from"`
-	Gas                  string   `json:"gas"`
-	GasPrice             string   `json:"gasPrice"`
-	MaxPriorityFeePerGas string   `json:"maxPriorityFeePerGas"`
-	MaxFeePerGas         string   `json:"maxFeePerGas"`
-	Hash                 string   `json:"hash"`
-	Input                string   `json:"input"`
-	Nonce                string   `json:"nonce"`
-	To                   string   `json:"to"`
-	TransactionIndex     string   `json:"transactionIndex"`
-	Value                string   `json:"value"`
-	Type                 string   `json:"type"`
-	AccessList           []interface{} `json:"accessList"`
-	ChainID              string   `json:"chainId"`
-	V                    string   `json:"v"`
-	YParity              string   `json:"yParity"`
-	R                    string   `json:"r"`
-	S                    string   `json:"s"`
+	BlockHash            Hash                `json:"blockHash"`
+	BlockNumber          Uint64              `json:"blockNumber"`
+	BlockTimestamp       Uint64              `json:"blockTimestamp,omitempty"` // timestamp of the including block, copied from the block if the node leaves it out.
+	From                 Address             `json:"from"`
+	Gas                  Uint64              `json:"gas"`
+	GasPrice             *Wei                `json:"gasPrice"`
+	MaxPriorityFeePerGas *Wei                `json:"maxPriorityFeePerGas,omitempty"` // dynamic fee, blob and set code transactions only.
+	MaxFeePerGas         *Wei                `json:"maxFeePerGas,omitempty"`         // dynamic fee, blob and set code transactions only.
+	Hash                 Hash                `json:"hash"`
+	Input                string              `json:"input"`
+	Nonce                Uint64              `json:"nonce"`
+	To                   Address             `json:"to"` // empty for a contract creation.
+	TransactionIndex     Uint64              `json:"transactionIndex"`
+	Value                *Wei                `json:"value"`
+	Type                 Uint64              `json:"type"`
+	TypeName             string              `json:"typeName"` // name of Type, see TxTypeName.
+	AccessList           []*ETHAccessTuple   `json:"accessList"`
+	MaxFeePerBlobGas     *Wei                `json:"maxFeePerBlobGas,omitempty"`    // blob transactions only.
+	BlobVersionedHashes  []Hash              `json:"blobVersionedHashes,omitempty"` // blob transactions only.
+	AuthorizationList    []*ETHAuthorization `json:"authorizationList,omitempty"`   // set code transactions only.
+	ChainID              *Big                `json:"chainId,omitempty"`
+	V                    *Big                `json:"v"`
+	YParity              *Big                `json:"yParity,omitempty"`
+	R                    *Big                `json:"r"`
+	S                    *Big                `json:"s"`
+	Receipt              *ETHReceiptInfo     `json:"receipt,omitempty"`         // attached to matched transactions, not part of the block object.
+	ContractCreated      Address             `json:"contractCreated,omitempty"` // address of the contract deployed by this transaction, resolved from its receipt.
 }
 
+// ETHBlockInfo block object with full transactions, quantities are decoded from hex.
 type ETHBlockInfo struct {
-	BaseFeePerGas         string `json:"baseFeePerGas"`
-	BlobGasUsed           string `json:"blobGasUsed"`
-	Difficulty            string `json:"difficulty"`
-	ExcessBlobGas         string `json:"excessBlobGas"`
-	ExtraData             string `json:"extraData"`
-	GasLimit              string `json:"gasLimit"`
-	GasUsed               string `json:"gasUsed"`
-	Hash                  string `json:"hash"`
-	LogsBloom             string `json:"logsBloom"`
-	Miner                 string `json:"miner"`
-	MixHash               string `json:"mixHash"`
-	Nonce                 string `json:"nonce"`
-	Number                string `json:"number"`
-	ParentBeaconBlockRoot string `json:"parentBeaconBlockRoot"`
-	ParentHash            string `json:"parentHash"`
-	ReceiptsRoot          string `json:"receiptsRoot"`
-	Sha3Uncles            string `json:"sha3Uncles"`
-	Size                  string `json:"size"`
-	StateRoot             string `json:"stateRoot"`
-	Timestamp             string `json:"timestamp"`
-	TotalDifficulty       string `json:"totalDifficulty"`
-	Transactions          []*ETHTransaction `json:"transactions"`
-	TransactionsRoot string        `json:"transactionsRoot"`
-	Uncles           []interface{} `json:"uncles"`
-	Withdrawals      []*ETHWithdraw `json:"withdrawals"`
-	WithdrawalsRoot string `json:"withdrawalsRoot"`
+	BaseFeePerGas         *Wei                   `json:"baseFeePerGas,omitempty"` // since London.
+	BlobGasUsed           *Uint64                `json:"blobGasUsed,omitempty"`   // since Cancun.
+	Difficulty            *Big                   `json:"difficulty"`
+	ExcessBlobGas         *Uint64                `json:"excessBlobGas,omitempty"` // since Cancun.
+	ExtraData             string                 `json:"extraData"`
+	GasLimit              Uint64                 `json:"gasLimit"`
+	GasUsed               Uint64                 `json:"gasUsed"`
+	Hash                  Hash                   `json:"hash"`
+	LogsBloom             string                 `json:"logsBloom"`
+	Miner                 Address                `json:"miner"`
+	MixHash               Hash                   `json:"mixHash"`
+	Nonce                 string                 `json:"nonce"` // 8 bytes of data, not a quantity.
+	Number                Uint64                 `json:"number"`
+	ParentBeaconBlockRoot Hash                   `json:"parentBeaconBlockRoot,omitempty"`
+	ParentHash            Hash                   `json:"parentHash"`
+	ReceiptsRoot          Hash                   `json:"receiptsRoot"`
+	Sha3Uncles            Hash                   `json:"sha3Uncles"`
+	Size                  Uint64                 `json:"size"`
+	StateRoot             Hash                   `json:"stateRoot"`
+	Timestamp             Uint64                 `json:"timestamp"`
+	TotalDifficulty       *Big                   `json:"totalDifficulty,omitempty"`
+	Transactions          []*ETHTransaction      `json:"transactions"`
+	TransactionsRoot      Hash                   `json:"transactionsRoot"`
+	Uncles                []interface{}          `json:"uncles"`
+	Withdrawals           []*ETHWithdraw         `json:"withdrawals"`
+	Logs                  []*ETHLog              `json:"-"` // token event logs fetched with eth_getLogs, not part of the block object.
+	InternalTransfers     []*ETHInternalTransfer `json:"-"` // value-bearing internal calls from the tracer, nil if tracing is off.
+	WithdrawalsRoot       Hash                   `json:"withdrawalsRoot,omitempty"`
 }
 
 // ETHWithdraw ETH Withdraw infomation
 type ETHWithdraw struct {
-	Index          string `json:"index"`
-	ValidatorIndex string `json:"validatorIndex"`
-	Address        string `json:"address"`
-	Amount         string `json:"amount"`
-}
\ No newline at end of file
+	Index          Uint64  `json:"index"`
+	ValidatorIndex Uint64  `json:"validatorIndex"`
+	Address        Address `json:"address"`
+	Amount         Uint64  `json:"amount"` // gwei.
+}
+
+// ETHBlockHeader block header fields used to track chain head and finality.
+type ETHBlockHeader struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// JSONRPCNotification notification pushed by eth_subscribe, such as newHeads.
+type JSONRPCNotification struct {
+	JSONRPC string                     `json:"jsonrpc"`
+	Method  string                     `json:"method"` // eth_subscription.
+	Params  *JSONRPCSubscriptionResult `json:"params"`
+}
+
+// JSONRPCSubscriptionResult payload of a subscription notification.
+type JSONRPCSubscriptionResult struct {
+	Subscription string          `json:"subscription"`
+	Result       json.RawMessage `json:"result"`
+}
+
+// ETHLogFilter filter of eth_getLogs, topics entries are a topic, a list of alternatives or nil for any.
+type ETHLogFilter struct {
+	FromBlock string        `json:"fromBlock,omitempty"`
+	ToBlock   string        `json:"toBlock,omitempty"`
+	BlockHash string        `json:"blockHash,omitempty"`
+	Address   []string      `json:"address,omitempty"`
+	Topics    []interface{} `json:"topics,omitempty"`
+}
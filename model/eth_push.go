@@ -0,0 +1,49 @@
+package model
+
+// push event types, an event topic receives every event of its type.
+const (
+	PUSH_EVENT_TRANSACTION    = "transaction"    // a new transaction of a subscribed address.
+	PUSH_EVENT_TOKEN_TRANSFER = "token_transfer" // a new token transfer of a subscribed address.
+	PUSH_EVENT_CONFIRMED      = "confirmed"      // a transaction reached the confirmation threshold.
+	PUSH_EVENT_REMOVED        = "removed"        // a block was orphaned by a reorg and rolled back.
+)
+
+// push topic kinds, a topic is kind:value such as address:0x... or event:confirmed.
+const (
+	PUSH_TOPIC_ADDRESS = "address" // events of a subscribed address.
+	PUSH_TOPIC_TOKEN   = "token"   // token transfers of a token contract and their removal.
+	PUSH_TOPIC_EVENT   = "event"   // events of one type.
+)
+
+// push socket request methods.
+const (
+	PUSH_METHOD_SUBSCRIBE   = "subscribe"
+	PUSH_METHOD_UNSUBSCRIBE = "unsubscribe"
+)
+
+// ETHPushEvent an ingest event pushed to socket clients.
+type ETHPushEvent struct {
+	Type                string                    `json:"type"`             // PUSH_EVENT_*.
+	Addresses           []Address                 `json:"addresses"`        // subscribed addresses involved.
+	Tokens              []Address                 `json:"tokens,omitempty"` // token contracts involved.
+	BlockNumber         Uint64                    `json:"blockNumber"`
+	BlockHash           Hash                      `json:"blockHash"`
+	Transaction         *ETHTransactionWithStatus `json:"transaction,omitempty"`         // transaction and confirmed events.
+	TokenTransfer       *ETHTokenTransfer         `json:"tokenTransfer,omitempty"`       // token_transfer events.
+	RemovedTransactions []string                  `json:"removedTransactions,omitempty"` // removed events, hashes of the rolled back transactions.
+}
+
+// ETHPushRequest a client message on the push socket.
+type ETHPushRequest struct {
+	ID     int64    `json:"id"`     // echoed by the reply.
+	Method string   `json:"method"` // PUSH_METHOD_*.
+	Topics []string `json:"topics"`
+}
+
+// ETHPushMessage a server message on the push socket, either the reply to a request or a pushed event.
+type ETHPushMessage struct {
+	ID     *int64        `json:"id,omitempty"` // id of the request replied to.
+	Error  string        `json:"error,omitempty"`
+	Topics []string      `json:"topics"` // topics of the connection in a reply, topics the event matched in a push.
+	Event  *ETHPushEvent `json:"event,omitempty"`
+}
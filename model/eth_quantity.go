@@ -0,0 +1,191 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/sugarshop/token-gateway/util"
+)
+
+// JSON-RPC encodes quantities as 0x prefixed hex strings, the types below decode them once
+// so the rest of the code works with numbers, and encode them back to hex for storage and the API.
+
+// Uint64 quantity fitting 64 bits: block numbers, indexes, gas and nonces.
+type Uint64 uint64
+
+// Big arbitrary precision quantity which is not an amount of ether, such as a token amount or a difficulty.
+type Big big.Int
+
+// Wei amount of ether in wei: values, gas prices and fees.
+type Wei big.Int
+
+// Address 20 bytes account address, lowercased when decoded.
+type Address string
+
+// Hash 32 bytes hash, lowercased when decoded.
+type Hash string
+
+// NewBig return n as a Big.
+func NewBig(n *big.Int) *Big {
+	return (*Big)(n)
+}
+
+// NewWei return n as a Wei.
+func NewWei(n *big.Int) *Wei {
+	return (*Wei)(n)
+}
+
+// MarshalJSON encode q as hex.
+func (q Uint64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(q.String())
+}
+
+// UnmarshalJSON decode a hex quantity, null and "" leave q unchanged.
+func (q *Uint64) UnmarshalJSON(data []byte) error {
+	text, ok, err := quantityText(data)
+	if err != nil || !ok {
+		return err
+	}
+	n, err := strconv.ParseUint(text, 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid uint64 quantity %s", data)
+	}
+	*q = Uint64(n)
+	return nil
+}
+
+// String hex encoding of q.
+func (q Uint64) String() string {
+	return "0x" + strconv.FormatUint(uint64(q), 16)
+}
+
+// Int return b as a big.Int, zero if b is nil.
+func (b *Big) Int() *big.Int {
+	if b == nil {
+		return new(big.Int)
+	}
+	return (*big.Int)(b)
+}
+
+// MarshalJSON encode b as hex.
+func (b *Big) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.String())
+}
+
+// UnmarshalJSON decode a hex quantity, null and "" leave b unchanged.
+func (b *Big) UnmarshalJSON(data []byte) error {
+	return unmarshalBig(data, (*big.Int)(b))
+}
+
+// String hex encoding of b.
+func (b *Big) String() string {
+	return "0x" + b.Int().Text(16)
+}
+
+// Int return w as a big.Int, zero if w is nil.
+func (w *Wei) Int() *big.Int {
+	if w == nil {
+		return new(big.Int)
+	}
+	return (*big.Int)(w)
+}
+
+// MarshalJSON encode w as hex.
+func (w *Wei) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.String())
+}
+
+// UnmarshalJSON decode a hex quantity, null and "" leave w unchanged.
+func (w *Wei) UnmarshalJSON(data []byte) error {
+	return unmarshalBig(data, (*big.Int)(w))
+}
+
+// String hex encoding of w.
+func (w *Wei) String() string {
+	return "0x" + w.Int().Text(16)
+}
+
+// Ether decimal amount of ether, without trailing zeros.
+func (w *Wei) Ether() string {
+	n := w.Int()
+	digits := new(big.Int).Abs(n).Text(10)
+	if len(digits) <= 18 {
+		digits = strings.Repeat("0", 19-len(digits)) + digits
+	}
+	whole, fraction := digits[:len(digits)-18], strings.TrimRight(digits[len(digits)-18:], "0")
+	if n.Sign() < 0 {
+		whole = "-" + whole
+	}
+	if len(fraction) == 0 {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+// MarshalJSON encode an address in its EIP-55 checksum case, addresses are kept lowercase everywhere else.
+func (a Address) MarshalJSON() ([]byte, error) {
+	return json.Marshal(util.ChecksumAddress(string(a)))
+}
+
+// UnmarshalJSON decode an address, null leaves a unchanged.
+func (a *Address) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*a = Address(strings.ToLower(text))
+	return nil
+}
+
+// UnmarshalJSON decode a hash, null leaves h unchanged.
+func (h *Hash) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*h = Hash(strings.ToLower(text))
+	return nil
+}
+
+// unmarshalBig decode a hex quantity into n.
+func unmarshalBig(data []byte, n *big.Int) error {
+	text, ok, err := quantityText(data)
+	if err != nil || !ok {
+		return err
+	}
+	if _, ok := n.SetString(text, 16); !ok {
+		return fmt.Errorf("invalid big quantity %s", data)
+	}
+	return nil
+}
+
+// quantityText return the hex digits of a JSON quantity, ok is false for null and "".
+func quantityText(data []byte) (string, bool, error) {
+	if string(data) == "null" {
+		return "", false, nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return "", false, err
+	}
+	if len(text) == 0 {
+		return "", false, nil
+	}
+	if !strings.HasPrefix(text, "0x") && !strings.HasPrefix(text, "0X") {
+		return "", false, errors.New("hex quantity without 0x prefix")
+	}
+	if len(text) == 2 {
+		return "0", true, nil
+	}
+	return text[2:], true, nil
+}
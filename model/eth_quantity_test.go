@@ -0,0 +1,91 @@
+package model
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestQuantity_JSON(t *testing.T) {
+	tx := &ETHTransaction{}
+	err := json.Unmarshal([]byte(`{"blockNumber":"0x10","from":"0xAE2Fc483527B8EF99EB5D9B44875F005ba1FaE13","to":null,
+		"value":"0xde0b6b3a7640000","gasPrice":"0x","maxFeePerGas":"","hash":"0xABCD"}`), tx)
+	assert.Nil(t, err)
+	assert.Equal(t, Uint64(16), tx.BlockNumber)
+	assert.Equal(t, Address("0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"), tx.From)
+	assert.Equal(t, Address(""), tx.To)
+	assert.Equal(t, big.NewInt(1e18), tx.Value.Int())
+	assert.Equal(t, int64(0), tx.GasPrice.Int().Int64())
+	assert.Nil(t, tx.MaxPriorityFeePerGas)
+	assert.Equal(t, int64(0), tx.MaxFeePerGas.Int().Int64())
+	assert.Equal(t, Hash("0xabcd"), tx.Hash)
+
+	data, err := json.Marshal(tx)
+	assert.Nil(t, err)
+	decoded := &ETHTransaction{}
+	assert.Nil(t, json.Unmarshal(data, decoded))
+	again, err := json.Marshal(decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, string(data), string(again))
+	assert.Contains(t, string(data), `"blockNumber":"0x10"`)
+	assert.Contains(t, string(data), `"value":"0xde0b6b3a7640000"`)
+	assert.Contains(t, string(data), `"from":"0xae2Fc483527B8EF99EB5D9B44875F005ba1FaE13"`)
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"blockNumber":"10"}`), &ETHTransaction{}))
+	assert.NotNil(t, json.Unmarshal([]byte(`{"value":"0xzz"}`), &ETHTransaction{}))
+}
+
+func TestWei_Ether(t *testing.T) {
+	for wei, ether := range map[string]string{
+		"0":                    "0",
+		"1":                    "0.000000000000000001",
+		"1000000000":           "0.000000001",
+		"1500000000000000000":  "1.5",
+		"32000000000000000000": "32",
+		"-2500000000000000000": "-2.5",
+	} {
+		n, _ := new(big.Int).SetString(wei, 10)
+		assert.Equal(t, ether, NewWei(n).Ether(), wei)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	status := &ETHTransactionWithStatus{
+		ETHTransaction: &ETHTransaction{
+			BlockNumber: 0x10,
+			From:        "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13",
+			Value:       NewWei(big.NewInt(1.5e18)),
+			ChainID:     NewBig(big.NewInt(1)),
+		},
+		Confirmations: 3,
+	}
+	data := map[string]interface{}{"transactions": []*ETHTransactionWithStatus{status}}
+
+	raw, err := Format(data, FORMAT_HEX)
+	assert.Nil(t, err)
+	assert.Equal(t, data, raw)
+
+	formatted, err := Format(data, FORMAT_DECIMAL)
+	assert.Nil(t, err)
+	tx := formatted.(map[string]interface{})["transactions"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, uint64(16), tx["blockNumber"])
+	assert.Equal(t, Address("0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"), tx["from"])
+	assert.Equal(t, "1500000000000000000", tx["value"])
+	assert.Equal(t, "1", tx["chainId"])
+	assert.Equal(t, nil, tx["gasPrice"])
+	assert.Equal(t, int64(3), tx["confirmations"])
+	// omitempty and json:"-" fields are left out.
+	_, ok := tx["maxFeePerGas"]
+	assert.False(t, ok)
+	_, ok = tx["receipt"]
+	assert.False(t, ok)
+
+	formatted, err = Format(status, FORMAT_ETH)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.5", formatted.(map[string]interface{})["value"])
+
+	_, err = Format(data, "wei")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,52 @@
+package model
+
+// ETHTransactionReceipt receipt of a mined transaction.
+type ETHTransactionReceipt struct {
+	BlockHash         Hash      `json:"blockHash"`
+	BlockNumber       Uint64    `json:"blockNumber"`
+	ContractAddress   Address   `json:"contractAddress"`
+	CumulativeGasUsed Uint64    `json:"cumulativeGasUsed"`
+	EffectiveGasPrice *Wei      `json:"effectiveGasPrice"`
+	From              Address   `json:"from"`
+	GasUsed           Uint64    `json:"gasUsed"`
+	BlobGasUsed       *Uint64   `json:"blobGasUsed,omitempty"`
+	BlobGasPrice      *Wei      `json:"blobGasPrice,omitempty"`
+	Logs              []*ETHLog `json:"logs"`
+	LogsBloom         string    `json:"logsBloom"`
+	Status            *Uint64   `json:"status,omitempty"` // 1 success, 0 failure, absent before Byzantium.
+	To                Address   `json:"to"`
+	TransactionHash   Hash      `json:"transactionHash"`
+	TransactionIndex  Uint64    `json:"transactionIndex"`
+	Type              Uint64    `json:"type"`
+}
+
+// ETHLog event log emitted by a transaction.
+type ETHLog struct {
+	Address          Address  `json:"address"`
+	Topics           []string `json:"topics"`
+	Data             string   `json:"data"`
+	BlockNumber      Uint64   `json:"blockNumber"`
+	BlockHash        Hash     `json:"blockHash"`
+	TransactionHash  Hash     `json:"transactionHash"`
+	TransactionIndex Uint64   `json:"transactionIndex"`
+	LogIndex         Uint64   `json:"logIndex"`
+	Removed          bool     `json:"removed"`
+}
+
+// receipt status.
+const (
+	RECEIPT_STATUS_SUCCESS = "success"
+	RECEIPT_STATUS_FAILED  = "failed" // reverted, only the fee was paid.
+)
+
+// ETHReceiptInfo outcome and cost of a matched transaction, taken from its receipt.
+type ETHReceiptInfo struct {
+	Status            string    `json:"status"` // RECEIPT_STATUS_*, empty before Byzantium.
+	GasUsed           Uint64    `json:"gasUsed"`
+	EffectiveGasPrice *Wei      `json:"effectiveGasPrice"`
+	ContractAddress   Address   `json:"contractAddress,omitempty"` // set if the transaction created a contract.
+	BlobGasUsed       *Uint64   `json:"blobGasUsed,omitempty"`
+	BlobGasPrice      *Wei      `json:"blobGasPrice,omitempty"`
+	Fee               *Wei      `json:"fee"` // gasUsed * effectiveGasPrice + blobGasUsed * blobGasPrice.
+	Logs              []*ETHLog `json:"logs"`
+}
@@ -0,0 +1,13 @@
+package model
+
+// ETHReorgEvent describe a chain reorganization observed by the ingest loop.
+type ETHReorgEvent struct {
+	DetectedAt          int64    `json:"detectedAt"`          // unix seconds.
+	BlockNumber         int64    `json:"blockNumber"`         // height of the first canonical block re-ingested.
+	CommonAncestor      int64    `json:"commonAncestor"`      // last block shared by the orphaned and canonical branch, -1 if unrecoverable.
+	Depth               int      `json:"depth"`               // number of orphaned blocks.
+	OrphanedBlocks      []string `json:"orphanedBlocks"`      // hashes of orphaned blocks.
+	RemovedTransactions []string `json:"removedTransactions"` // hashes of transactions rolled back.
+	RemovedWithdrawals  []string `json:"removedWithdrawals"`  // indexes of withdrawals rolled back.
+	Unrecoverable       bool     `json:"unrecoverable"`       // the fork is older than the reorg window, blocks before it were not rolled back.
+}
@@ -0,0 +1,39 @@
+package model
+
+// ETHSubscription an address whose inbound/outbound transactions are tracked.
+type ETHSubscription struct {
+	Address    Address `json:"address"`
+	CreatedAt  int64   `json:"createdAt"`          // unix seconds.
+	StartBlock int64   `json:"startBlock"`         // first block captured by live ingestion, earlier history comes from backfill.
+	Deployer   Address `json:"deployer,omitempty"` // set if subscribed automatically as a contract deployed by this subscribed address.
+	Label      string  `json:"label,omitempty"`    // free text set by the subscriber.
+	Owner      string  `json:"owner,omitempty"`    // who the address is tracked for, listings can be filtered by it.
+}
+
+// ETHSubscribeRequest subscribe an address, also a row of a bulk subscribe.
+type ETHSubscribeRequest struct {
+	Address   string `json:"address"`
+	FromBlock int64  `json:"-"` // backfill history from this block, negative for none, bulk subscribe never backfills.
+	Label     string `json:"label"`
+	Owner     string `json:"owner"`
+}
+
+// ETHSubscribeResult outcome of one row of a bulk subscribe.
+type ETHSubscribeResult struct {
+	Address Address `json:"address"`
+	OK      bool    `json:"ok"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// ETHBulkSubscribeResult outcome of a bulk subscribe, results are in row order.
+type ETHBulkSubscribeResult struct {
+	Subscribed int                   `json:"subscribed"`
+	Failed     int                   `json:"failed"`
+	Results    []*ETHSubscribeResult `json:"results"`
+}
+
+// ETHSubscriptionPage page of a subscription listing ordered by address.
+type ETHSubscriptionPage struct {
+	Subscriptions []*ETHSubscription `json:"subscriptions"`
+	NextCursor    string             `json:"nextCursor,omitempty"` // empty on the last page.
+}
@@ -0,0 +1,32 @@
+package model
+
+// event topics of token transfers, keccak256 of the event signature.
+const (
+	TOPIC_TRANSFER        = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" // Transfer(address,address,uint256), ERC-20 and ERC-721.
+	TOPIC_TRANSFER_SINGLE = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62" // TransferSingle(address,address,address,uint256,uint256), ERC-1155.
+	TOPIC_TRANSFER_BATCH  = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb" // TransferBatch(address,address,address,uint256[],uint256[]), ERC-1155.
+)
+
+// token standards.
+const (
+	TOKEN_STANDARD_ERC20   = "erc20"
+	TOKEN_STANDARD_ERC721  = "erc721"
+	TOKEN_STANDARD_ERC1155 = "erc1155"
+)
+
+// ETHTokenTransfer token transfer decoded from an event log, one per moved token id for ERC-1155 batches.
+type ETHTokenTransfer struct {
+	Standard         string  `json:"standard"`           // TOKEN_STANDARD_*.
+	Token            Address `json:"token"`              // token contract address.
+	Operator         Address `json:"operator,omitempty"` // ERC-1155 only, the address moving the tokens.
+	From             Address `json:"from"`
+	To               Address `json:"to"`
+	TokenID          *Big    `json:"tokenId,omitempty"` // ERC-721 and ERC-1155 token id.
+	Value            *Big    `json:"value"`             // amount in the smallest token unit, 1 for ERC-721.
+	TransactionHash  Hash    `json:"transactionHash"`
+	TransactionIndex Uint64  `json:"transactionIndex"`
+	BlockNumber      Uint64  `json:"blockNumber"`
+	BlockHash        Hash    `json:"blockHash"`
+	LogIndex         Uint64  `json:"logIndex"`
+	BatchIndex       int     `json:"batchIndex"` // position in an ERC-1155 TransferBatch, 0 otherwise.
+}
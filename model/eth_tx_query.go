@@ -0,0 +1,111 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// direction of a transaction relative to the queried address.
+const (
+	TX_DIRECTION_INBOUND  = "inbound"  // sent to the address by another account, or the creation of the address.
+	TX_DIRECTION_OUTBOUND = "outbound" // sent by the address to another account.
+	TX_DIRECTION_SELF     = "self"     // sent by the address to itself.
+)
+
+// listing order by block number and transaction index.
+const (
+	ORDER_ASC  = "asc"
+	ORDER_DESC = "desc"
+)
+
+// page size of a listing.
+const (
+	DEFAULT_PAGE_LIMIT = 100
+	MAX_PAGE_LIMIT     = 1000
+)
+
+// ETHTxQuery page and filters of a transaction listing, zero values do not filter.
+type ETHTxQuery struct {
+	Cursor    string   // nextCursor of the previous page, empty for the first page.
+	Limit     int      // page size, DEFAULT_PAGE_LIMIT if zero.
+	Order     string   // ORDER_ASC or ORDER_DESC, ORDER_ASC if empty.
+	Direction string   // TX_DIRECTION_INBOUND, TX_DIRECTION_OUTBOUND or TX_DIRECTION_SELF.
+	FromBlock uint64   // inclusive.
+	ToBlock   uint64   // inclusive, zero is unbounded.
+	FromTime  uint64   // block timestamp in unix seconds, inclusive.
+	ToTime    uint64   // block timestamp in unix seconds, inclusive, zero is unbounded.
+	MinValue  *big.Int // wei, inclusive.
+	Type      *Uint64  // transaction type, see TxTypeName.
+}
+
+// ETHTxPage page of a transaction listing.
+type ETHTxPage struct {
+	Transactions []*ETHTransactionWithStatus `json:"transactions"`
+	NextCursor   string                      `json:"nextCursor,omitempty"` // empty on the last page.
+}
+
+// Check validate the query and fill in its defaults.
+func (q *ETHTxQuery) Check() error {
+	switch {
+	case q.Limit == 0:
+		q.Limit = DEFAULT_PAGE_LIMIT
+	case q.Limit < 0 || q.Limit > MAX_PAGE_LIMIT:
+		return fmt.Errorf("limit must be between 1 and %d", MAX_PAGE_LIMIT)
+	}
+	switch q.Order {
+	case "":
+		q.Order = ORDER_ASC
+	case ORDER_ASC, ORDER_DESC:
+	default:
+		return fmt.Errorf("unknown order %q", q.Order)
+	}
+	switch q.Direction {
+	case "", TX_DIRECTION_INBOUND, TX_DIRECTION_OUTBOUND, TX_DIRECTION_SELF:
+	default:
+		return fmt.Errorf("unknown direction %q", q.Direction)
+	}
+	if q.ToBlock > 0 && q.ToBlock < q.FromBlock {
+		return fmt.Errorf("to_block %d before from_block %d", q.ToBlock, q.FromBlock)
+	}
+	if q.ToTime > 0 && q.ToTime < q.FromTime {
+		return fmt.Errorf("to_time %d before from_time %d", q.ToTime, q.FromTime)
+	}
+	return nil
+}
+
+// TxDirection direction of tx relative to address.
+func TxDirection(address string, tx *ETHTransaction) string {
+	from, to := string(tx.From), string(tx.To)
+	switch {
+	case from == address && to == address:
+		return TX_DIRECTION_SELF
+	case from == address:
+		return TX_DIRECTION_OUTBOUND
+	default:
+		return TX_DIRECTION_INBOUND
+	}
+}
+
+// Match report whether tx of address passes the filters of the query.
+func (q *ETHTxQuery) Match(address string, tx *ETHTransaction) bool {
+	if len(q.Direction) > 0 && TxDirection(address, tx) != q.Direction {
+		return false
+	}
+	if uint64(tx.BlockNumber) < q.FromBlock || (q.ToBlock > 0 && uint64(tx.BlockNumber) > q.ToBlock) {
+		return false
+	}
+	if q.FromTime > 0 || q.ToTime > 0 {
+		// transactions stored without a block timestamp never match a time range.
+		timestamp := uint64(tx.BlockTimestamp)
+		if timestamp == 0 || timestamp < q.FromTime || (q.ToTime > 0 && timestamp > q.ToTime) {
+			return false
+		}
+	}
+	if q.MinValue != nil && tx.Value.Int().Cmp(q.MinValue) < 0 {
+		return false
+	}
+	if q.Type != nil && tx.Type != *q.Type {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestETHTxQuery_Check(t *testing.T) {
+	query := &ETHTxQuery{}
+	assert.Nil(t, query.Check())
+	assert.Equal(t, DEFAULT_PAGE_LIMIT, query.Limit)
+	assert.Equal(t, ORDER_ASC, query.Order)
+
+	for _, query := range []*ETHTxQuery{
+		{Limit: MAX_PAGE_LIMIT + 1},
+		{Order: "newest"},
+		{Direction: "in"},
+		{FromBlock: 10, ToBlock: 9},
+		{FromTime: 10, ToTime: 9},
+	} {
+		assert.NotNil(t, query.Check(), query)
+	}
+
+	for s, want := range map[string]Uint64{"blob": TX_TYPE_BLOB, "set_code": TX_TYPE_SET_CODE, "2": TX_TYPE_DYNAMIC_FEE, "0x7e": 0x7e} {
+		txType, err := ParseTxType(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, txType, s)
+	}
+	_, err := ParseTxType("eip1559")
+	assert.NotNil(t, err)
+}
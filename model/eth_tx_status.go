@@ -0,0 +1,15 @@
+package model
+
+// transaction settlement status.
+const (
+	TX_STATUS_PENDING_CONFIRMATION = "pending_confirmation" // less than the configured confirmation blocks.
+	TX_STATUS_CONFIRMED            = "confirmed"            // at least the configured confirmation blocks.
+	TX_STATUS_FINALIZED            = "finalized"            // included at or below the finalized block.
+)
+
+// ETHTransactionWithStatus transaction annotated with how settled it is against the current head.
+type ETHTransactionWithStatus struct {
+	*ETHTransaction
+	Confirmations int64  `json:"confirmations"`
+	Status        string `json:"status"`
+}
@@ -0,0 +1,8 @@
+package model
+
+// ETHTxEvent a transaction pushed to a stream, a stream resumed from ID continues after this transaction.
+type ETHTxEvent struct {
+	ID          string                    `json:"id"`
+	Addresses   []Address                 `json:"addresses"` // streamed addresses the transaction is sent from, to or creates.
+	Transaction *ETHTransactionWithStatus `json:"transaction"`
+}
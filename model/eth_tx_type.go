@@ -0,0 +1,122 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// transaction types, see EIP-2718.
+const (
+	TX_TYPE_LEGACY      Uint64 = 0x0 // before EIP-2718.
+	TX_TYPE_ACCESS_LIST Uint64 = 0x1 // EIP-2930.
+	TX_TYPE_DYNAMIC_FEE Uint64 = 0x2 // EIP-1559.
+	TX_TYPE_BLOB        Uint64 = 0x3 // EIP-4844.
+	TX_TYPE_SET_CODE    Uint64 = 0x4 // EIP-7702.
+)
+
+// transaction type names exposed by the API.
+const (
+	TX_TYPE_NAME_LEGACY      = "legacy"
+	TX_TYPE_NAME_ACCESS_LIST = "access_list"
+	TX_TYPE_NAME_DYNAMIC_FEE = "dynamic_fee"
+	TX_TYPE_NAME_BLOB        = "blob"
+	TX_TYPE_NAME_SET_CODE    = "set_code"
+	TX_TYPE_NAME_UNKNOWN     = "unknown" // a type this gateway does not know, such as an L2 deposit.
+)
+
+// ETHAccessTuple storage slots of an address warmed by an access list, EIP-2930.
+type ETHAccessTuple struct {
+	Address     Address `json:"address"`
+	StorageKeys []Hash  `json:"storageKeys"`
+}
+
+// ETHAuthorization signed delegation of an account to contract code, EIP-7702.
+type ETHAuthorization struct {
+	ChainID *Big    `json:"chainId"`
+	Address Address `json:"address"` // the code the authority delegates to.
+	Nonce   Uint64  `json:"nonce"`
+	YParity *Big    `json:"yParity"`
+	R       *Big    `json:"r"`
+	S       *Big    `json:"s"`
+}
+
+// TxTypeName name of a transaction type.
+func TxTypeName(txType Uint64) string {
+	switch txType {
+	case TX_TYPE_LEGACY:
+		return TX_TYPE_NAME_LEGACY
+	case TX_TYPE_ACCESS_LIST:
+		return TX_TYPE_NAME_ACCESS_LIST
+	case TX_TYPE_DYNAMIC_FEE:
+		return TX_TYPE_NAME_DYNAMIC_FEE
+	case TX_TYPE_BLOB:
+		return TX_TYPE_NAME_BLOB
+	case TX_TYPE_SET_CODE:
+		return TX_TYPE_NAME_SET_CODE
+	default:
+		return TX_TYPE_NAME_UNKNOWN
+	}
+}
+
+// ParseTxType parse a transaction type given by name or number, decimal or 0x hex.
+func ParseTxType(s string) (Uint64, error) {
+	for txType := TX_TYPE_LEGACY; txType <= TX_TYPE_SET_CODE; txType++ {
+		if s == TxTypeName(txType) {
+			return txType, nil
+		}
+	}
+	num, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unknown transaction type %q", s)
+	}
+	return Uint64(num), nil
+}
+
+// UnmarshalJSON decode a transaction and name its type.
+func (tx *ETHTransaction) UnmarshalJSON(data []byte) error {
+	// the alias drops the method, so decoding does not recurse.
+	type transaction ETHTransaction
+	if err := json.Unmarshal(data, (*transaction)(tx)); err != nil {
+		return err
+	}
+	tx.TypeName = TxTypeName(tx.Type)
+	return nil
+}
+
+// UnmarshalJSON decode a block and stamp its transactions with the block timestamp,
+// their type specific fields are not checked, see ETHTransaction.Validate.
+func (b *ETHBlockInfo) UnmarshalJSON(data []byte) error {
+	type blockInfo ETHBlockInfo
+	if err := json.Unmarshal(data, (*blockInfo)(b)); err != nil {
+		return err
+	}
+	for _, tx := range b.Transactions {
+		if tx.BlockTimestamp == 0 {
+			tx.BlockTimestamp = b.Timestamp
+		}
+	}
+	return nil
+}
+
+// Validate check the type specific fields of tx, unknown types are not checked.
+// stored transactions are not checked since they may predate the typed fields.
+func (tx *ETHTransaction) Validate() error {
+	switch tx.Type {
+	case TX_TYPE_DYNAMIC_FEE, TX_TYPE_BLOB, TX_TYPE_SET_CODE:
+		if tx.MaxFeePerGas == nil || tx.MaxPriorityFeePerGas == nil {
+			return fmt.Errorf("%s transaction %s without fee caps", TxTypeName(tx.Type), tx.Hash)
+		}
+	}
+	switch tx.Type {
+	case TX_TYPE_BLOB:
+		if tx.MaxFeePerBlobGas == nil || len(tx.BlobVersionedHashes) == 0 {
+			return fmt.Errorf("blob transaction %s without blob fields", tx.Hash)
+		}
+	case TX_TYPE_SET_CODE:
+		if len(tx.AuthorizationList) == 0 {
+			return fmt.Errorf("set code transaction %s without authorization list", tx.Hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestETHTransaction_Types(t *testing.T) {
+	const fees = `"maxFeePerGas":"0x2","maxPriorityFeePerGas":"0x1"`
+	for raw, name := range map[string]string{
+		`{"hash":"0x1"}`:                           TX_TYPE_NAME_LEGACY,
+		`{"hash":"0x1","type":"0x0"}`:              TX_TYPE_NAME_LEGACY,
+		`{"hash":"0x1","type":"0x1"}`:              TX_TYPE_NAME_ACCESS_LIST,
+		`{"hash":"0x1","type":"0x2",` + fees + `}`: TX_TYPE_NAME_DYNAMIC_FEE,
+		`{"hash":"0x1","type":"0x7e"}`:             TX_TYPE_NAME_UNKNOWN,
+	} {
+		tx := &ETHTransaction{}
+		assert.Nil(t, json.Unmarshal([]byte(raw), tx), raw)
+		assert.Equal(t, name, tx.TypeName, raw)
+		assert.Nil(t, tx.Validate(), raw)
+	}
+
+	tx := &ETHTransaction{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"hash":"0x1","type":"0x1","to":"0x2","accessList":[
+		{"address":"0xAE2Fc483527B8EF99EB5D9B44875F005ba1FaE13","storageKeys":["0x00","0x01"]}]}`), tx))
+	assert.Equal(t, 1, len(tx.AccessList))
+	assert.Equal(t, Address("0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"), tx.AccessList[0].Address)
+	assert.Equal(t, []Hash{"0x00", "0x01"}, tx.AccessList[0].StorageKeys)
+
+	blob := `{"hash":"0x1","type":"0x3","to":"0x2",` + fees + `,"maxFeePerBlobGas":"0x3","blobVersionedHashes":["0x01AB"]}`
+	tx = &ETHTransaction{}
+	assert.Nil(t, json.Unmarshal([]byte(blob), tx))
+	assert.Nil(t, tx.Validate())
+	assert.Equal(t, TX_TYPE_NAME_BLOB, tx.TypeName)
+	assert.Equal(t, int64(3), tx.MaxFeePerBlobGas.Int().Int64())
+	assert.Equal(t, []Hash{"0x01ab"}, tx.BlobVersionedHashes)
+
+	setCode := `{"hash":"0x1","type":"0x4","to":"0x2",` + fees + `,"authorizationList":[
+		{"chainId":"0x1","address":"0x3","nonce":"0x5","yParity":"0x1","r":"0xa","s":"0xb"}]}`
+	tx = &ETHTransaction{}
+	assert.Nil(t, json.Unmarshal([]byte(setCode), tx))
+	assert.Nil(t, tx.Validate())
+	assert.Equal(t, TX_TYPE_NAME_SET_CODE, tx.TypeName)
+	assert.Equal(t, 1, len(tx.AuthorizationList))
+	assert.Equal(t, Address("0x3"), tx.AuthorizationList[0].Address)
+	assert.Equal(t, Uint64(5), tx.AuthorizationList[0].Nonce)
+	assert.Equal(t, int64(1), tx.AuthorizationList[0].ChainID.Int().Int64())
+
+	data, err := json.Marshal(tx)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"typeName":"set_code"`)
+	assert.Contains(t, string(data), `"authorizationList":[{"chainId":"0x1","address":"0x3","nonce":"0x5"`)
+
+	for _, raw := range []string{
+		`{"hash":"0x1","type":"0x2"}`,
+		`{"hash":"0x1","type":"0x3","to":"0x2",` + fees + `,"maxFeePerBlobGas":"0x3","blobVersionedHashes":[]}`,
+		`{"hash":"0x1","type":"0x4","to":"0x2",` + fees + `,"authorizationList":[]}`,
+	} {
+		tx = &ETHTransaction{}
+		assert.Nil(t, json.Unmarshal([]byte(raw), tx), raw)
+		assert.NotNil(t, tx.Validate(), raw)
+		// a block from the node still decodes, the caller decides about the invalid transaction.
+		block := &ETHBlockInfo{}
+		assert.Nil(t, json.Unmarshal([]byte(`{"transactions":[`+raw+`]}`), block), raw)
+		assert.Equal(t, 1, len(block.Transactions), raw)
+	}
+	block := &ETHBlockInfo{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"number":"0x1","timestamp":"0x64","transactions":[`+blob+`,`+setCode+`]}`), block))
+	assert.Equal(t, Uint64(1), block.Number)
+	assert.Equal(t, TX_TYPE_NAME_BLOB, block.Transactions[0].TypeName)
+	// transactions are stamped with the block timestamp.
+	assert.Equal(t, Uint64(100), block.Transactions[1].BlockTimestamp)
+}
@@ -0,0 +1,13 @@
+package model
+
+// ETHWithdrawal beacon chain withdrawal credited to a subscribed address, an inbound event without transaction.
+type ETHWithdrawal struct {
+	Index          Uint64  `json:"index"` // withdrawal index, unique across the chain.
+	ValidatorIndex Uint64  `json:"validatorIndex"`
+	Address        Address `json:"address"`
+	Amount         *Wei    `json:"amount"`     // converted from the gwei amount of the block.
+	AmountGwei     Uint64  `json:"amountGwei"` // as in the block.
+	BlockNumber    Uint64  `json:"blockNumber"`
+	BlockHash      Hash    `json:"blockHash"`
+	Timestamp      Uint64  `json:"timestamp"` // block timestamp.
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// output formats of quantities, selected by the format query parameter.
+const (
+	FORMAT_HEX     = "hex"     // raw JSON-RPC hex, the default.
+	FORMAT_DECIMAL = "decimal" // Uint64 as numbers, Big and Wei as decimal strings.
+	FORMAT_ETH     = "eth"     // as decimal, but Wei as a decimal amount of ether.
+)
+
+var (
+	uint64Type = reflect.TypeOf(Uint64(0))
+	bigType    = reflect.TypeOf(Big{})
+	weiType    = reflect.TypeOf(Wei{})
+	marshaler  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// CheckFormat return an error if format is not one of FORMAT_*, empty means FORMAT_HEX.
+func CheckFormat(format string) error {
+	switch format {
+	case "", FORMAT_HEX, FORMAT_DECIMAL, FORMAT_ETH:
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// Format return v with its quantities rendered in format, v itself for FORMAT_HEX.
+// structs become maps keyed by their json names, so the output keeps the same shape.
+func Format(v interface{}, format string) (interface{}, error) {
+	if err := CheckFormat(format); err != nil {
+		return nil, err
+	}
+	if len(format) == 0 || format == FORMAT_HEX {
+		return v, nil
+	}
+	return formatValue(reflect.ValueOf(v), format), nil
+}
+
+// formatValue render v, recursing into pointers, structs, slices and maps.
+func formatValue(v reflect.Value, format string) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Type() {
+	case uint64Type:
+		return v.Uint()
+	case bigType:
+		n := v.Interface().(Big)
+		return (&n).Int().Text(10)
+	case weiType:
+		n := v.Interface().(Wei)
+		if format == FORMAT_ETH {
+			return (&n).Ether()
+		}
+		return (&n).Int().Text(10)
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if elem := v.Elem(); v.Kind() == reflect.Interface || elem.Type() == bigType || elem.Type() == weiType {
+			return formatValue(elem, format)
+		}
+		if v.Type().Implements(marshaler) {
+			return v.Interface()
+		}
+		return formatValue(v.Elem(), format)
+	case reflect.Struct:
+		if v.Type().Implements(marshaler) {
+			return v.Interface()
+		}
+		m := map[string]interface{}{}
+		formatStruct(m, v, format)
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Implements(marshaler) || v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = formatValue(v.Index(i), format)
+		}
+		return list
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = formatValue(iter.Value(), format)
+		}
+		return m
+	default:
+		return v.Interface()
+	}
+}
+
+// formatStruct render the exported fields of v into m by json name, honouring "-" and omitempty,
+// fields of embedded structs are promoted like encoding/json does.
+func formatStruct(m map[string]interface{}, v reflect.Value, format string) {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		tag, tagged := field.Tag.Lookup("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && len(name) == 0 {
+			if value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					continue
+				}
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				formatStruct(m, value, format)
+				continue
+			}
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		if !tagged || len(name) == 0 {
+			name = field.Name
+		}
+		if strings.Contains(tag, ",omitempty") && value.IsZero() {
+			continue
+		}
+		m[name] = formatValue(value, format)
+	}
+}
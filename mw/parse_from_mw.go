@@ -3,6 +3,7 @@ package mw
 import (
 	"io"
 	"log"
+	"net/http"
 
 	"bytes"
 	"github.com/gin-gonic/gin"
@@ -16,7 +17,14 @@ func ParseFormMiddleware(c *gin.Context) {
 		log.Println(ctx, "parse form failed ", err)
 	}
 
-	body, err := io.ReadAll(c.Request.Body)
+	// the body is buffered whole, bound it so a large upload cannot exhaust memory.
+	limit := util.EnvInt64("MAX_BODY_BYTES", 32<<20)
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+	if int64(len(body)) > limit {
+		log.Println(ctx, "request body exceeds limit: ", limit)
+		c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		log.Println(ctx, "read request body error: ", err)
 	}
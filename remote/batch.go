@@ -0,0 +1,255 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// requestID last JSON-RPC request id, ids are unique per process so batch responses can be matched back.
+var requestID int64
+
+// nextRequestID return a unique JSON-RPC request id.
+func nextRequestID() int {
+	return int(atomic.AddInt64(&requestID, 1))
+}
+
+// newRequest build a JSON-RPC request with a unique id.
+func newRequest(method string, params ...interface{}) *model.JSONRPCRequest {
+	if params == nil {
+		params = []interface{}{}
+	}
+	return &model.JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      nextRequestID(),
+	}
+}
+
+// responseError convert the error object of a JSON-RPC response to *RPCError, nil if it succeeded.
+func responseError(method string, resp *model.JSONRPCResponse) error {
+	if resp.Error == nil {
+		return nil
+	}
+	return newRPCError(method, resp.Error)
+}
+
+// BatchCall send requests as one JSON-RPC batch POST.
+// responses are matched back by id and returned in request order, servers may answer in any order.
+// a request without response gets a response carrying an error object, per-item errors are left to the caller.
+func (s *ETHRPCService) BatchCall(ctx context.Context, requests []*model.JSONRPCRequest) ([]*model.JSONRPCResponse, error) {
+	if len(requests) == 0 {
+		return []*model.JSONRPCResponse{}, nil
+	}
+	var responses []*model.JSONRPCResponse
+	err := s.do(ctx, nil, func(e *endpoint) error {
+		var err error
+		responses, err = s.batchCallOnce(ctx, e, requests)
+		return err
+	})
+	return responses, err
+}
+
+// batchCallOnce send requests as one batch to e.
+func (s *ETHRPCService) batchCallOnce(ctx context.Context, e *endpoint, requests []*model.JSONRPCRequest) ([]*model.JSONRPCResponse, error) {
+	body, err := s.httpJsonRPCPOST(ctx, e, "batch", requests)
+	if err != nil {
+		log.Println(ctx, "[BatchCall]: Error httpJsonRPCPOST request:", err)
+		return nil, err
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		// the whole batch was rejected with a single response, such as batch too large.
+		single := &model.JSONRPCResponse{}
+		if err := json.Unmarshal(body, single); err != nil {
+			log.Println(ctx, "[BatchCall]: Error Unmarshal, err: ", err)
+			return nil, err
+		}
+		if err := responseError(requests[0].Method, single); err != nil {
+			log.Println(ctx, "[BatchCall]: batch rejected, err: ", err)
+			return nil, err
+		}
+		return nil, errors.New("unexpected single response to batch request")
+	}
+	list := make([]*model.JSONRPCResponse, 0, len(requests))
+	if err := json.Unmarshal(body, &list); err != nil {
+		log.Println(ctx, "[BatchCall]: Error Unmarshal, err: ", err)
+		return nil, err
+	}
+	byID := make(map[int]*model.JSONRPCResponse, len(list))
+	for _, resp := range list {
+		byID[resp.ID] = resp
+	}
+	responses := make([]*model.JSONRPCResponse, len(requests))
+	for i, request := range requests {
+		resp, ok := byID[request.ID]
+		if !ok {
+			resp = &model.JSONRPCResponse{
+				JSONRPC: "2.0",
+				ID:      request.ID,
+				Error:   &model.JSONRPCError{Code: -32603, Message: "missing response in batch"},
+			}
+		}
+		responses[i] = resp
+	}
+	return responses, nil
+}
+
+// batchDecode send requests as one batch and decode each result into results[i], results must be pointers.
+// it fails on the first per-item error or empty result, the whole batch is retried with the policy of the first method,
+// on another endpoint if there is one, since a lagging endpoint does not know the latest blocks yet.
+func (s *ETHRPCService) batchDecode(ctx context.Context, requests []*model.JSONRPCRequest, results []interface{}) error {
+	if len(requests) == 0 {
+		return nil
+	}
+	tried := map[*endpoint]bool{}
+	return s.withRetry(ctx, requests[0].Method, func() error {
+		return s.do(ctx, tried, func(e *endpoint) error {
+			responses, err := s.batchCallOnce(ctx, e, requests)
+			if err != nil {
+				return err
+			}
+			for i, resp := range responses {
+				if err := responseError(requests[i].Method, resp); err != nil {
+					return err
+				}
+				if len(resp.Result) == 0 || string(resp.Result) == "null" {
+					return newEmptyResultError(requests[i].Method)
+				}
+				if err := json.Unmarshal(resp.Result, results[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// EthGetBlocksByNumber returns blocks with full transactions of numbers in one batch, in the same order.
+func (s *ETHRPCService) EthGetBlocksByNumber(ctx context.Context, numbers []int64) ([]*model.ETHBlockInfo, error) {
+	requests := make([]*model.JSONRPCRequest, len(numbers))
+	blocks := make([]*model.ETHBlockInfo, len(numbers))
+	results := make([]interface{}, len(numbers))
+	for i, number := range numbers {
+		requests[i] = newRequest("eth_getBlockByNumber", fmt.Sprintf("0x%x", number), true)
+		blocks[i] = &model.ETHBlockInfo{}
+		results[i] = blocks[i]
+	}
+	if err := s.batchDecode(ctx, requests, results); err != nil {
+		log.Println(ctx, "[EthGetBlocksByNumber]: Error batchDecode, err: ", err)
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// EthGetBlocksWithLogs returns blocks of numbers like EthGetBlocksByNumber, with their logs matching topics
+// attached, fetched by eth_getLogs in the same batch. topics entries are alternatives for the first topic.
+// when the logs of the whole range exceed a provider cap, they are fetched again by halves of the range.
+func (s *ETHRPCService) EthGetBlocksWithLogs(ctx context.Context, numbers []int64, topics []string) ([]*model.ETHBlockInfo, error) {
+	if len(numbers) == 0 {
+		return []*model.ETHBlockInfo{}, nil
+	}
+	fromBlock, toBlock := numbers[0], numbers[len(numbers)-1]
+	requests := make([]*model.JSONRPCRequest, len(numbers)+1)
+	blocks := make([]*model.ETHBlockInfo, len(numbers))
+	results := make([]interface{}, len(numbers)+1)
+	for i, number := range numbers {
+		requests[i] = newRequest("eth_getBlockByNumber", fmt.Sprintf("0x%x", number), true)
+		blocks[i] = &model.ETHBlockInfo{}
+		results[i] = blocks[i]
+	}
+	logs := make([]*model.ETHLog, 0)
+	requests[len(numbers)] = newLogsRequest(fromBlock, toBlock, topics)
+	results[len(numbers)] = &logs
+	err := s.batchDecode(ctx, requests, results)
+	if errors.Is(err, ErrResultTooLarge) {
+		log.Println(ctx, "[EthGetBlocksWithLogs]: logs of blocks:", fromBlock, "-", toBlock, "too large, split the range")
+		if blocks, err = s.EthGetBlocksByNumber(ctx, numbers); err != nil {
+			return nil, err
+		}
+		logs, err = s.ethGetLogsByHalves(ctx, fromBlock, toBlock, topics)
+	}
+	if err != nil {
+		log.Println(ctx, "[EthGetBlocksWithLogs]: Error batchDecode, err: ", err)
+		return nil, err
+	}
+	byHash := make(map[string]*model.ETHBlockInfo, len(blocks))
+	for _, block := range blocks {
+		block.Logs = make([]*model.ETHLog, 0)
+		byHash[string(block.Hash)] = block
+	}
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+		block, ok := byHash[string(l.BlockHash)]
+		if !ok {
+			// the chain reorganized between the block and the log queries.
+			log.Println(ctx, "[EthGetBlocksWithLogs]: log of unknown block:", l.BlockNumber, l.BlockHash)
+			return nil, errors.New("logs do not match fetched blocks")
+		}
+		block.Logs = append(block.Logs, l)
+	}
+	return blocks, nil
+}
+
+// newLogsRequest eth_getLogs request of blocks [fromBlock, toBlock] whose first topic is one of topics.
+func newLogsRequest(fromBlock, toBlock int64, topics []string) *model.JSONRPCRequest {
+	return newRequest("eth_getLogs", &model.ETHLogFilter{
+		FromBlock: fmt.Sprintf("0x%x", fromBlock),
+		ToBlock:   fmt.Sprintf("0x%x", toBlock),
+		Topics:    []interface{}{topics},
+	})
+}
+
+// ethGetLogs return logs of blocks [fromBlock, toBlock] matching topics, by halves of the range while it exceeds a provider cap.
+func (s *ETHRPCService) ethGetLogs(ctx context.Context, fromBlock, toBlock int64, topics []string) ([]*model.ETHLog, error) {
+	logs := make([]*model.ETHLog, 0)
+	err := s.batchDecode(ctx, []*model.JSONRPCRequest{newLogsRequest(fromBlock, toBlock, topics)}, []interface{}{&logs})
+	if errors.Is(err, ErrResultTooLarge) {
+		return s.ethGetLogsByHalves(ctx, fromBlock, toBlock, topics)
+	}
+	return logs, err
+}
+
+// ethGetLogsByHalves return logs of blocks [fromBlock, toBlock] queried as two halves,
+// a single block over the cap cannot be split and fails.
+func (s *ETHRPCService) ethGetLogsByHalves(ctx context.Context, fromBlock, toBlock int64, topics []string) ([]*model.ETHLog, error) {
+	if fromBlock == toBlock {
+		return nil, &RPCError{Method: "eth_getLogs", Message: fmt.Sprintf("logs of block %d exceed the provider cap", fromBlock), Kind: ErrResultTooLarge}
+	}
+	middle := fromBlock + (toBlock-fromBlock)/2
+	logs, err := s.ethGetLogs(ctx, fromBlock, middle, topics)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := s.ethGetLogs(ctx, middle+1, toBlock, topics)
+	if err != nil {
+		return nil, err
+	}
+	return append(logs, upper...), nil
+}
+
+// EthGetTransactionReceipts returns receipts of transaction hashes in one batch, in the same order.
+func (s *ETHRPCService) EthGetTransactionReceipts(ctx context.Context, hashes []string) ([]*model.ETHTransactionReceipt, error) {
+	requests := make([]*model.JSONRPCRequest, len(hashes))
+	receipts := make([]*model.ETHTransactionReceipt, len(hashes))
+	results := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		requests[i] = newRequest("eth_getTransactionReceipt", hash)
+		receipts[i] = &model.ETHTransactionReceipt{}
+		results[i] = receipts[i]
+	}
+	if err := s.batchDecode(ctx, requests, results); err != nil {
+		log.Println(ctx, "[EthGetTransactionReceipts]: Error batchDecode, err: ", err)
+		return nil, err
+	}
+	return receipts, nil
+}
@@ -0,0 +1,146 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+// newBatchTestServer answer a batch in reverse order, failing the request with method "fail" and dropping "drop".
+func newBatchTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests := []*model.JSONRPCRequest{}
+		assert.Nil(t, json.Unmarshal(body, &requests))
+		responses := []map[string]interface{}{}
+		for i := len(requests) - 1; i >= 0; i-- {
+			request := requests[i]
+			switch request.Method {
+			case "fail":
+				responses = append(responses, map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "error": map[string]interface{}{"code": -32602, "message": "invalid params"}})
+			case "drop":
+			default:
+				responses = append(responses, map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": request.Params[0]})
+			}
+		}
+		json.NewEncoder(w).Encode(responses)
+	}))
+}
+
+func TestRPCService_BatchCall(t *testing.T) {
+	ctx := context.Background()
+	server := newBatchTestServer(t)
+	defer server.Close()
+	s := &ETHRPCService{endpoints: []*endpoint{newEndpoint(server.URL, 0, 1, nil)}}
+
+	requests := []*model.JSONRPCRequest{
+		newRequest("echo", "0x1"),
+		newRequest("fail", "0x2"),
+		newRequest("echo", "0x3"),
+		newRequest("drop", "0x4"),
+	}
+	responses, err := s.BatchCall(ctx, requests)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(responses))
+	for i, resp := range responses {
+		assert.Equal(t, requests[i].ID, resp.ID)
+	}
+	assert.Equal(t, `"0x1"`, string(responses[0].Result))
+	assert.Equal(t, -32602, responses[1].Error.Code)
+	assert.Equal(t, `"0x3"`, string(responses[2].Result))
+	assert.NotNil(t, responses[3].Error)
+}
+
+func TestRPCService_EthGetBlocksWithLogs(t *testing.T) {
+	ctx := context.Background()
+	logBlockHash := "0xh11"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests := []*model.JSONRPCRequest{}
+		assert.Nil(t, json.Unmarshal(body, &requests))
+		responses := []map[string]interface{}{}
+		for _, request := range requests {
+			var result interface{}
+			switch request.Method {
+			case "eth_getBlockByNumber":
+				number := request.Params[0].(string)
+				result = map[string]interface{}{"number": number, "hash": "0xh" + number[2:]}
+			case "eth_getLogs":
+				filter := request.Params[0].(map[string]interface{})
+				assert.Equal(t, "0x10", filter["fromBlock"])
+				assert.Equal(t, "0x11", filter["toBlock"])
+				result = []map[string]interface{}{
+					{"blockHash": logBlockHash, "blockNumber": "0x11", "logIndex": "0x0"},
+					{"blockHash": "0xorphan", "blockNumber": "0x11", "logIndex": "0x1", "removed": true},
+				}
+			}
+			responses = append(responses, map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": result})
+		}
+		json.NewEncoder(w).Encode(responses)
+	}))
+	defer server.Close()
+	s := &ETHRPCService{endpoints: []*endpoint{newEndpoint(server.URL, 0, 1, nil)}}
+
+	blocks, err := s.EthGetBlocksWithLogs(ctx, []int64{0x10, 0x11}, []string{model.TOPIC_TRANSFER})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(blocks))
+	assert.Equal(t, 0, len(blocks[0].Logs))
+	assert.Equal(t, 1, len(blocks[1].Logs))
+
+	// logs of a block hash not fetched, the chain reorganized in between.
+	logBlockHash = "0xother"
+	_, err = s.EthGetBlocksWithLogs(ctx, []int64{0x10, 0x11}, []string{model.TOPIC_TRANSFER})
+	assert.NotNil(t, err)
+}
+
+func TestRPCService_EthGetBlocksWithLogsSplit(t *testing.T) {
+	ctx := context.Background()
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests := []*model.JSONRPCRequest{}
+		assert.Nil(t, json.Unmarshal(body, &requests))
+		responses := []map[string]interface{}{}
+		for _, request := range requests {
+			response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+			switch request.Method {
+			case "eth_getBlockByNumber":
+				number := request.Params[0].(string)
+				response["result"] = map[string]interface{}{"number": number, "hash": "0xh" + number[2:]}
+			case "eth_getLogs":
+				filter := request.Params[0].(map[string]interface{})
+				from, to := filter["fromBlock"].(string), filter["toBlock"].(string)
+				ranges = append(ranges, from+"-"+to)
+				if from != to {
+					// the provider caps results of any range wider than one block.
+					response["error"] = map[string]interface{}{"code": -32005, "message": "query returned more than 10000 results"}
+				} else {
+					response["result"] = []map[string]interface{}{{"blockHash": "0xh" + from[2:], "blockNumber": from, "logIndex": "0x0"}}
+				}
+			}
+			responses = append(responses, response)
+		}
+		json.NewEncoder(w).Encode(responses)
+	}))
+	defer server.Close()
+	s := &ETHRPCService{
+		endpoints: []*endpoint{newEndpoint(server.URL, 0, 1, nil)},
+		retry:     parseRetryPolicies(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, ""),
+	}
+
+	blocks, err := s.EthGetBlocksWithLogs(ctx, []int64{0x10, 0x11, 0x12}, []string{model.TOPIC_TRANSFER})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(blocks))
+	for _, block := range blocks {
+		assert.Equal(t, 1, len(block.Logs))
+	}
+	// the oversized range is not retried as is, but halved down to single blocks.
+	assert.Equal(t, []string{"0x10-0x12", "0x10-0x11", "0x10-0x10", "0x11-0x11", "0x12-0x12"}, ranges)
+}
@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// circuit breaker states.
+const (
+	BREAKER_CLOSED    = "closed"    // requests flow.
+	BREAKER_OPEN      = "open"      // requests fail fast until the open timeout elapses.
+	BREAKER_HALF_OPEN = "half_open" // one probe request decides whether to close or open again.
+)
+
+// circuitBreaker stop hammering a failing endpoint after consecutive upstream failures.
+type circuitBreaker struct {
+	mutex       sync.Mutex
+	threshold   int           // consecutive failures opening the breaker.
+	openTimeout time.Duration // how long the breaker stays open before a probe.
+	state       string
+	failures    int
+	probing     bool
+	openedAt    time.Time
+	lastError   string
+}
+
+func newCircuitBreaker(threshold int, openTimeout time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &circuitBreaker{threshold: threshold, openTimeout: openTimeout, state: BREAKER_CLOSED}
+}
+
+// Allow return ErrCircuitOpen if the request must not be sent.
+func (b *circuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BREAKER_OPEN:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = BREAKER_HALF_OPEN
+		b.probing = true
+		return nil
+	case BREAKER_HALF_OPEN:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record update the breaker with the outcome of an allowed request.
+// only failures telling the endpoint is unhealthy count, a rejected request proves it is alive.
+func (b *circuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		// the caller gave up, nothing learned about the endpoint.
+		return
+	}
+	if !isEndpointFailure(err) {
+		b.state = BREAKER_CLOSED
+		b.failures = 0
+		return
+	}
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == BREAKER_HALF_OPEN || b.failures >= b.threshold {
+		b.state = BREAKER_OPEN
+		b.openedAt = time.Now()
+	}
+}
+
+// State return a snapshot of the breaker for health output.
+func (b *circuitBreaker) State() *model.CircuitBreakerState {
+	if b == nil {
+		return &model.CircuitBreakerState{State: BREAKER_CLOSED}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state := &model.CircuitBreakerState{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != BREAKER_CLOSED {
+		state.OpenedAt = b.openedAt.Unix()
+	}
+	return state
+}
+
+// isEndpointFailure report whether err means the endpoint is unhealthy.
+func isEndpointFailure(err error) bool {
+	return errors.Is(err, ErrUpstreamTimeout) || errors.Is(err, ErrUpstreamUnavailable) || errors.Is(err, ErrRateLimited)
+}
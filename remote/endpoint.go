@@ -0,0 +1,240 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// endpoint one upstream JSON-RPC provider with its own circuit breaker and stats.
+type endpoint struct {
+	url      string
+	priority int // lower is preferred, backups only serve while every preferred endpoint is unhealthy.
+	weight   int // share of requests among endpoints of the same priority.
+	breaker  *circuitBreaker
+
+	mutex       sync.Mutex
+	head        int64 // last head seen by the health check.
+	lagging     bool  // head is too far behind the best endpoint.
+	requests    int64
+	failures    int64
+	latency     time.Duration // total latency of requests.
+	lastError   string
+	lastCheckAt int64
+}
+
+func newEndpoint(url string, priority, weight int, breaker *circuitBreaker) *endpoint {
+	if weight <= 0 {
+		weight = 1
+	}
+	return &endpoint{url: url, priority: priority, weight: weight, breaker: breaker}
+}
+
+// parseEndpoints parse a list of endpoints separated by ",", such as
+// "https://primary.example/key|0|3,https://backup.example/key|1", each entry is url[|priority[|weight]].
+func parseEndpoints(list string, breaker func() *circuitBreaker) ([]*endpoint, error) {
+	endpoints := make([]*endpoint, 0)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		fields := strings.Split(entry, "|")
+		priority, weight := 0, 1
+		var err error
+		if len(fields) > 1 {
+			if priority, err = strconv.Atoi(strings.TrimSpace(fields[1])); err != nil {
+				return nil, errors.New("invalid endpoint priority: " + entry)
+			}
+		}
+		if len(fields) > 2 {
+			if weight, err = strconv.Atoi(strings.TrimSpace(fields[2])); err != nil {
+				return nil, errors.New("invalid endpoint weight: " + entry)
+			}
+		}
+		endpoints = append(endpoints, newEndpoint(strings.TrimSpace(fields[0]), priority, weight, breaker()))
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoint")
+	}
+	return endpoints, nil
+}
+
+// record update stats with the outcome of a request.
+func (e *endpoint) record(latency time.Duration, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.requests++
+	e.latency += latency
+	if err != nil && !errors.Is(err, context.Canceled) {
+		e.failures++
+		e.lastError = err.Error()
+	}
+}
+
+// isLagging report whether the health check found the endpoint behind.
+func (e *endpoint) isLagging() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.lagging
+}
+
+// name return the endpoint url without path and query, they often carry the provider api key.
+func (e *endpoint) name() string {
+	u, err := url.Parse(e.url)
+	if err != nil || len(u.Host) == 0 {
+		return "invalid"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// stats return a snapshot of the endpoint for health output.
+func (e *endpoint) stats(bestHead int64) *model.RPCEndpointStats {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	stats := &model.RPCEndpointStats{
+		Name:        e.name(),
+		Priority:    e.priority,
+		Weight:      e.weight,
+		Head:        e.head,
+		Lagging:     e.lagging,
+		Requests:    e.requests,
+		Failures:    e.failures,
+		LastError:   e.lastError,
+		LastCheckAt: e.lastCheckAt,
+		Breaker:     e.breaker.State(),
+	}
+	if e.head > 0 && bestHead > e.head {
+		stats.Lag = bestHead - e.head
+	}
+	if e.requests > 0 {
+		stats.AvgLatencyMs = (e.latency / time.Duration(e.requests)).Milliseconds()
+	}
+	return stats
+}
+
+// candidates return endpoints in the order they should be tried:
+// by priority, then shuffled by weight so the load spreads across endpoints of the same priority.
+func candidates(endpoints []*endpoint) []*endpoint {
+	keys := make(map[*endpoint]float64, len(endpoints))
+	for _, e := range endpoints {
+		// weighted random order, see Efraimidis and Spirakis.
+		keys[e] = -rand.ExpFloat64() / float64(e.weight)
+	}
+	ordered := append([]*endpoint{}, endpoints...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].priority != ordered[j].priority {
+			return ordered[i].priority < ordered[j].priority
+		}
+		return keys[ordered[i]] > keys[ordered[j]]
+	})
+	return ordered
+}
+
+// pick return the endpoint serving the next request, skipping endpoints tried by this call,
+// lagging or with an open breaker. it falls back to lagging then tried endpoints before giving up.
+func (s *ETHRPCService) pick(tried map[*endpoint]bool) (*endpoint, error) {
+	ordered := candidates(s.endpoints)
+	passes := []func(e *endpoint) bool{
+		func(e *endpoint) bool { return !tried[e] && !e.isLagging() },
+		func(e *endpoint) bool { return !tried[e] },
+		func(e *endpoint) bool { return true },
+	}
+	for _, eligible := range passes {
+		for _, e := range ordered {
+			if eligible(e) && e.breaker.Allow() == nil {
+				return e, nil
+			}
+		}
+	}
+	return nil, ErrCircuitOpen
+}
+
+// do run fn against one endpoint, recording the outcome in its breaker and stats.
+// the endpoint is added to tried so the next attempt of the same call fails over to another one.
+func (s *ETHRPCService) do(ctx context.Context, tried map[*endpoint]bool, fn func(e *endpoint) error) error {
+	e, err := s.pick(tried)
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	err = fn(e)
+	e.breaker.Record(err)
+	e.record(time.Since(started), err)
+	if err != nil && tried != nil {
+		tried[e] = true
+	}
+	return err
+}
+
+// checkHeads query the head of every endpoint and flag endpoints more than maxLag blocks behind the best one.
+func (s *ETHRPCService) checkHeads(ctx context.Context) {
+	heads := make([]int64, len(s.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range s.endpoints {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, s.healthTimeout())
+			defer cancel()
+			request := newRequest("eth_blockNumber")
+			var hexNumber string
+			started := time.Now()
+			err := s.callOnce(ctx, e, request, &hexNumber)
+			e.record(time.Since(started), err)
+			if err != nil {
+				log.Println(ctx, "[checkHeads]: endpoint:", e.name(), "Error eth_blockNumber, err: ", err)
+				heads[i] = -1
+				return
+			}
+			heads[i], _ = strconv.ParseInt(hexNumber, 0, 64)
+		}(i, e)
+	}
+	wg.Wait()
+
+	var best int64
+	for _, head := range heads {
+		if head > best {
+			best = head
+		}
+	}
+	now := time.Now().Unix()
+	for i, e := range s.endpoints {
+		e.mutex.Lock()
+		e.lastCheckAt = now
+		if heads[i] >= 0 {
+			e.head = heads[i]
+		}
+		// an endpoint failing the check is left to its breaker.
+		e.lagging = heads[i] >= 0 && best-heads[i] > s.maxLag
+		e.mutex.Unlock()
+	}
+	atomic.StoreInt64(&s.bestHead, best)
+}
+
+// healthTimeout bound one health check request.
+func (s *ETHRPCService) healthTimeout() time.Duration {
+	if s.checkInterval > 0 {
+		return s.checkInterval
+	}
+	return 5 * time.Second
+}
+
+// runHealthCheck check endpoint heads every checkInterval, only needed with more than one endpoint.
+func (s *ETHRPCService) runHealthCheck() {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.checkHeads(context.Background())
+	}
+}
@@ -0,0 +1,109 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+// newHeadTestServer answer eth_blockNumber with head, or fail with 503 while down is set.
+func newHeadTestServer(head string, down *int32, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if atomic.LoadInt32(down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": head})
+	}))
+}
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := parseEndpoints("https://a.example/key|0|3, https://b.example/key|1,https://c.example", func() *circuitBreaker { return nil })
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(endpoints))
+	assert.Equal(t, 3, endpoints[0].weight)
+	assert.Equal(t, 1, endpoints[1].priority)
+	assert.Equal(t, "https://b.example", endpoints[1].name())
+	assert.Equal(t, 0, endpoints[2].priority)
+
+	_, err = parseEndpoints("https://a.example|x", func() *circuitBreaker { return nil })
+	assert.NotNil(t, err)
+	_, err = parseEndpoints(" ", func() *circuitBreaker { return nil })
+	assert.NotNil(t, err)
+}
+
+func TestRPCService_Failover(t *testing.T) {
+	ctx := context.Background()
+	var primaryDown, backupDown int32
+	var primaryCalls, backupCalls int32
+	primary := newHeadTestServer("0x64", &primaryDown, &primaryCalls)
+	defer primary.Close()
+	backup := newHeadTestServer("0x64", &backupDown, &backupCalls)
+	defer backup.Close()
+	s := &ETHRPCService{
+		endpoints: []*endpoint{
+			newEndpoint(primary.URL, 0, 1, newCircuitBreaker(1, time.Minute)),
+			newEndpoint(backup.URL, 1, 1, newCircuitBreaker(1, time.Minute)),
+		},
+		retry: parseRetryPolicies(RetryPolicy{MaxAttempts: 2}, ""),
+	}
+
+	// the preferred endpoint serves while healthy.
+	_, err := s.EthBlockNumber(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primaryCalls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&backupCalls))
+
+	// an outage fails over within the same call, then the open breaker keeps requests on the backup.
+	atomic.StoreInt32(&primaryDown, 1)
+	number, err := s.EthBlockNumber(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "0x64", number)
+	_, err = s.EthBlockNumber(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&primaryCalls))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&backupCalls))
+
+	health := s.Health()
+	assert.Equal(t, 1, health.Healthy)
+	assert.Equal(t, BREAKER_OPEN, health.Endpoints[0].Breaker.State)
+	assert.Equal(t, int64(2), health.Endpoints[0].Requests)
+	assert.Equal(t, int64(1), health.Endpoints[0].Failures)
+	assert.Equal(t, int64(2), health.Endpoints[1].Requests)
+}
+
+func TestRPCService_CheckHeads(t *testing.T) {
+	ctx := context.Background()
+	var down int32
+	var calls int32
+	ahead := newHeadTestServer("0x64", &down, &calls)
+	defer ahead.Close()
+	behind := newHeadTestServer("0x10", &down, &calls)
+	defer behind.Close()
+	s := &ETHRPCService{
+		endpoints: []*endpoint{
+			newEndpoint(behind.URL, 0, 1, nil),
+			newEndpoint(ahead.URL, 1, 1, nil),
+		},
+		maxLag: 5,
+	}
+
+	s.checkHeads(ctx)
+	health := s.Health()
+	assert.Equal(t, 1, health.Healthy)
+	assert.True(t, health.Endpoints[0].Lagging)
+	assert.Equal(t, int64(0x64-0x10), health.Endpoints[0].Lag)
+	assert.False(t, health.Endpoints[1].Lagging)
+
+	// the lagging endpoint is skipped despite its priority.
+	e, err := s.pick(map[*endpoint]bool{})
+	assert.Nil(t, err)
+	assert.Equal(t, ahead.URL, e.url)
+}
@@ -0,0 +1,138 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// error kinds of upstream JSON-RPC failures, callers branch on them with errors.Is.
+var (
+	ErrRateLimited         = errors.New("upstream rate limited")
+	ErrMethodNotFound      = errors.New("upstream method not found")
+	ErrInvalidParams       = errors.New("upstream invalid params")
+	ErrHeaderNotFound      = errors.New("upstream header not found")
+	ErrUpstreamTimeout     = errors.New("upstream timeout")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	ErrCircuitOpen         = errors.New("upstream circuit breaker open")
+	ErrResultTooLarge      = errors.New("upstream result too large")
+)
+
+// JSON-RPC error codes, see EIP-1474.
+const (
+	rpcCodeMethodNotFound   = -32601
+	rpcCodeInvalidParams    = -32602
+	rpcCodeLimitExceeded    = -32005
+	rpcCodeTooManyRequests  = -32029 // used by some providers for rate limiting.
+	rpcCodeResourceNotFound = -32001
+)
+
+// RPCError failure of a JSON-RPC call, either a JSON-RPC error object or a bad HTTP status.
+type RPCError struct {
+	Method     string // JSON-RPC method.
+	Code       int    // JSON-RPC error code, 0 if the failure is an HTTP status.
+	Message    string
+	HTTPStatus int   // HTTP status code, 0 if not known.
+	Kind       error // one of the Err* kinds.
+}
+
+// Error implement error.
+func (e *RPCError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s: %v: json-rpc error %d: %s", e.Method, e.Kind, e.Code, e.Message)
+	}
+	if e.HTTPStatus != 0 {
+		return fmt.Sprintf("%s: %v: http status %d: %s", e.Method, e.Kind, e.HTTPStatus, e.Message)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Method, e.Kind, e.Message)
+}
+
+// Unwrap make errors.Is(err, ErrRateLimited) and friends work.
+func (e *RPCError) Unwrap() error {
+	return e.Kind
+}
+
+// newRPCError classify the error object of a JSON-RPC response.
+func newRPCError(method string, rpcErr *model.JSONRPCError) *RPCError {
+	message := strings.ToLower(rpcErr.Message)
+	var kind error
+	switch {
+	case isResultTooLarge(message):
+		// checked first, providers report result caps with the limit exceeded code too.
+		kind = ErrResultTooLarge
+	case rpcErr.Code == rpcCodeLimitExceeded || rpcErr.Code == rpcCodeTooManyRequests ||
+		strings.Contains(message, "rate limit") || strings.Contains(message, "too many requests"):
+		kind = ErrRateLimited
+	case rpcErr.Code == rpcCodeMethodNotFound:
+		kind = ErrMethodNotFound
+	case strings.Contains(message, "header not found") || strings.Contains(message, "unknown block") ||
+		rpcErr.Code == rpcCodeResourceNotFound:
+		kind = ErrHeaderNotFound
+	case rpcErr.Code == rpcCodeInvalidParams:
+		kind = ErrInvalidParams
+	case strings.Contains(message, "timeout") || strings.Contains(message, "timed out"):
+		kind = ErrUpstreamTimeout
+	default:
+		kind = ErrUpstreamUnavailable
+	}
+	return &RPCError{Method: method, Code: rpcErr.Code, Message: rpcErr.Message, Kind: kind}
+}
+
+// isResultTooLarge report whether message is a provider cap on the size or block range of a query such as eth_getLogs,
+// for example "query returned more than 10000 results" or "log response size exceeded".
+func isResultTooLarge(message string) bool {
+	for _, limit := range []string{"more than 10000 results", "query returned more than", "response size", "response is too big",
+		"block range", "range is too large", "range too large", "too many blocks"} {
+		if strings.Contains(message, limit) {
+			return true
+		}
+	}
+	return false
+}
+
+// newHTTPStatusError classify a non-200 HTTP response.
+func newHTTPStatusError(method string, status int, body []byte) *RPCError {
+	var kind error
+	switch status {
+	case http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		kind = ErrUpstreamTimeout
+	default:
+		kind = ErrUpstreamUnavailable
+	}
+	message := string(body)
+	if len(message) > 256 {
+		message = message[:256]
+	}
+	return &RPCError{Method: method, Message: message, HTTPStatus: status, Kind: kind}
+}
+
+// newTransportError classify a failure to send the request or read its response.
+func newTransportError(method string, err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &RPCError{Method: method, Message: err.Error(), Kind: ErrUpstreamTimeout}
+	}
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	return &RPCError{Method: method, Message: err.Error(), Kind: ErrUpstreamUnavailable}
+}
+
+// newEmptyResultError a null result, the node does not know the requested block or transaction yet.
+func newEmptyResultError(method string) *RPCError {
+	return &RPCError{Method: method, Message: "empty result", Kind: ErrHeaderNotFound}
+}
+
+// IsRetryable report whether calling again may succeed, invalid and oversized requests never will
+// and an open circuit breaker must not be hammered.
+func IsRetryable(err error) bool {
+	return !errors.Is(err, ErrMethodNotFound) && !errors.Is(err, ErrInvalidParams) && !errors.Is(err, ErrResultTooLarge) &&
+		!errors.Is(err, ErrCircuitOpen) && !errors.Is(err, context.Canceled)
+}
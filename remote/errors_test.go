@@ -0,0 +1,43 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestRPCService_TypedErrors(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		Status int
+		Body   string
+		Kind   error
+	}{
+		{http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"daily request count exceeded"}}`, ErrRateLimited},
+		{http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"query returned more than 10000 results"}}`, ErrResultTooLarge},
+		{http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"Log response size exceeded."}}`, ErrResultTooLarge},
+		{http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"the method eth_foo does not exist"}}`, ErrMethodNotFound},
+		{http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"invalid argument 0"}}`, ErrInvalidParams},
+		{http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"}}`, ErrHeaderNotFound},
+		{http.StatusOK, `{"jsonrpc":"2.0","id":1,"result":null}`, ErrHeaderNotFound},
+		{http.StatusTooManyRequests, `too many requests`, ErrRateLimited},
+		{http.StatusGatewayTimeout, `gateway timeout`, ErrUpstreamTimeout},
+		{http.StatusServiceUnavailable, `unavailable`, ErrUpstreamUnavailable},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.Status)
+			w.Write([]byte(c.Body))
+		}))
+		s := &ETHRPCService{endpoints: []*endpoint{newEndpoint(server.URL, 0, 1, nil)}}
+		_, err := s.EthGetBlockByNumber(ctx, "0x1")
+		server.Close()
+		assert.True(t, errors.Is(err, c.Kind), c.Body)
+		rpcErr := &RPCError{}
+		assert.True(t, errors.As(err, &rpcErr), c.Body)
+	}
+}
@@ -0,0 +1,98 @@
+package remote
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy how a JSON-RPC method is retried, delays grow exponentially with full jitter.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts, 1 disable retry.
+	BaseDelay   time.Duration // delay cap of the first retry.
+	MaxDelay    time.Duration // delay cap of any retry.
+}
+
+// Backoff return the jittered delay before retry attempt, attempt starts at 1.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryPolicies default policy and per-method overrides.
+type retryPolicies struct {
+	fallback RetryPolicy
+	methods  map[string]RetryPolicy
+}
+
+// parseRetryPolicies parse per-method overrides such as
+// "eth_getBlockByNumber=5,100ms,2s;eth_blockNumber=2,50ms,500ms", malformed entries are ignored.
+func parseRetryPolicies(fallback RetryPolicy, overrides string) *retryPolicies {
+	policies := &retryPolicies{fallback: fallback, methods: map[string]RetryPolicy{}}
+	for _, entry := range strings.Split(overrides, ";") {
+		kv := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		fields := strings.Split(kv[1], ",")
+		if len(fields) != 3 {
+			log.Println("[parseRetryPolicies]: malformed retry policy:", entry)
+			continue
+		}
+		attempts, err1 := strconv.Atoi(strings.TrimSpace(fields[0]))
+		base, err2 := time.ParseDuration(strings.TrimSpace(fields[1]))
+		max, err3 := time.ParseDuration(strings.TrimSpace(fields[2]))
+		if err1 != nil || err2 != nil || err3 != nil {
+			log.Println("[parseRetryPolicies]: malformed retry policy:", entry)
+			continue
+		}
+		policies.methods[strings.TrimSpace(kv[0])] = RetryPolicy{MaxAttempts: attempts, BaseDelay: base, MaxDelay: max}
+	}
+	return policies
+}
+
+// policy return the retry policy of method.
+func (p *retryPolicies) policy(method string) RetryPolicy {
+	if p == nil {
+		return RetryPolicy{MaxAttempts: 1}
+	}
+	if policy, ok := p.methods[method]; ok {
+		return policy
+	}
+	return p.fallback
+}
+
+// withRetry call fn until it succeeds, fails with a non retryable error or attempts run out.
+// it never sleeps past the context deadline, the last error is returned instead.
+func (s *ETHRPCService) withRetry(ctx context.Context, method string, fn func() error) error {
+	policy := s.retry.policy(method)
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !IsRetryable(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+		delay := policy.Backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		log.Println(ctx, "[withRetry]:", method, "attempt:", attempt, "retry in:", delay, "err: ", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
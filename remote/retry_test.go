@@ -0,0 +1,100 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt := 1; attempt <= 5; attempt++ {
+		delay := policy.Backoff(attempt)
+		assert.True(t, delay >= 0 && delay <= 300*time.Millisecond)
+	}
+	assert.True(t, policy.Backoff(1) <= 100*time.Millisecond)
+
+	policies := parseRetryPolicies(policy, "eth_blockNumber=2,10ms,20ms;broken=1,x,2s")
+	assert.Equal(t, 2, policies.policy("eth_blockNumber").MaxAttempts)
+	assert.Equal(t, 5, policies.policy("broken").MaxAttempts)
+	assert.Equal(t, 1, (*retryPolicies)(nil).policy("eth_blockNumber").MaxAttempts)
+}
+
+func TestRPCService_RetryNullResult(t *testing.T) {
+	ctx := context.Background()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the node does not know the block on the first call.
+		if atomic.AddInt32(&calls, 1) == 1 {
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": nil})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": map[string]interface{}{"number": "0x10"}})
+	}))
+	defer server.Close()
+	s := &ETHRPCService{
+		endpoints: []*endpoint{newEndpoint(server.URL, 0, 1, nil)},
+		retry:     parseRetryPolicies(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, ""),
+	}
+
+	blockInfo, err := s.EthGetBlockByNumber(ctx, "0x10")
+	assert.Nil(t, err)
+	assert.Equal(t, model.Uint64(0x10), blockInfo.Number)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// invalid params is never retried.
+	atomic.StoreInt32(&calls, 0)
+	err = s.withRetry(ctx, "eth_getBlockByNumber", func() error {
+		atomic.AddInt32(&calls, 1)
+		return &RPCError{Method: "eth_getBlockByNumber", Kind: ErrInvalidParams}
+	})
+	assert.True(t, errors.Is(err, ErrInvalidParams))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	var calls int32
+	var healthy int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": "0x10"})
+	}))
+	defer server.Close()
+	s := &ETHRPCService{
+		endpoints: []*endpoint{newEndpoint(server.URL, 0, 1, newCircuitBreaker(2, 50*time.Millisecond))},
+	}
+
+	_, err := s.EthBlockNumber(ctx)
+	assert.True(t, errors.Is(err, ErrUpstreamUnavailable))
+	_, err = s.EthBlockNumber(ctx)
+	assert.True(t, errors.Is(err, ErrUpstreamUnavailable))
+	assert.Equal(t, BREAKER_OPEN, s.Health().Endpoints[0].Breaker.State)
+
+	// open: fail fast without calling the endpoint.
+	_, err = s.EthBlockNumber(ctx)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// after the open timeout a successful probe closes the breaker.
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(60 * time.Millisecond)
+	number, err := s.EthBlockNumber(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "0x10", number)
+	state := s.Health().Endpoints[0].Breaker
+	assert.Equal(t, BREAKER_CLOSED, state.State)
+	assert.Equal(t, 0, state.ConsecutiveFailures)
+}
@@ -10,14 +10,23 @@ import (
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sugarshop/env"
 	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/util"
 )
 
 // ETHRPCService ETH RPC service.
+// requests go to the preferred healthy endpoint and fail over to the others.
 type ETHRPCService struct {
-	ethJsonRPCURL string
+	endpoints []*endpoint
+	client *http.Client
+	retry *retryPolicies
+	maxLag int64 // blocks an endpoint may lag behind the best head before it is avoided.
+	checkInterval time.Duration
+	bestHead int64 // best head seen by the health check, accessed atomically.
 }
 
 var (
@@ -27,14 +36,36 @@ var (
 
 // ETHRPCServiceInstance ETHRPCService singleton
 func ETHRPCServiceInstance() *ETHRPCService {
-	url, ok := env.GlobalEnv().Get("ETHJSONRPCURL")
-	if !ok {
-		panic("no ETHJSONRPCURL env set")
+	urls, ok := env.GlobalEnv().Get("ETHJSONRPCURLS")
+	if !ok || len(urls) == 0 {
+		if urls, ok = env.GlobalEnv().Get("ETHJSONRPCURL"); !ok {
+			panic("no ETHJSONRPCURL env set")
+		}
 	}
 
 	ethRPCServiceOnce.Do(func() {
+		endpoints, err := parseEndpoints(urls, func() *circuitBreaker {
+			return newCircuitBreaker(
+				int(util.EnvInt64("RPC_BREAKER_THRESHOLD", 5)),
+				util.EnvDuration("RPC_BREAKER_OPEN_TIMEOUT", 30*time.Second),
+			)
+		})
+		if err != nil {
+			panic(err)
+		}
 		ethRPCServiceInstance = &ETHRPCService{
-			ethJsonRPCURL: url,
+			endpoints: endpoints,
+			client: &http.Client{Timeout: util.EnvDuration("RPC_TIMEOUT", 10*time.Second)},
+			retry: parseRetryPolicies(RetryPolicy{
+				MaxAttempts: int(util.EnvInt64("RPC_RETRY_MAX_ATTEMPTS", 3)),
+				BaseDelay:   util.EnvDuration("RPC_RETRY_BASE_DELAY", 100*time.Millisecond),
+				MaxDelay:    util.EnvDuration("RPC_RETRY_MAX_DELAY", 2*time.Second),
+			}, util.EnvString("RPC_RETRY_POLICIES", "")),
+			maxLag: util.EnvInt64("RPC_MAX_HEAD_LAG", 5),
+			checkInterval: util.EnvDuration("RPC_HEALTH_CHECK_INTERVAL", 5*time.Second),
+		}
+		if len(endpoints) > 1 {
+			go ethRPCServiceInstance.runHealthCheck()
 		}
 	})
 
@@ -67,23 +98,14 @@ func (s *ETHRPCService) EthBlockNumber(ctx context.Context) (string, error) {
 		JSONRPC: "2.0",
 		Method:  "eth_blockNumber",
 		Params:  []interface{}{},
-		ID:      83, // match response, debug, support multi-request, should be a uniq random number.
-	}
-
-	body, err := s.httpJsonRPCPOST(ctx, request)
-	if err != nil {
-		log.Println(ctx, "[EthBlockNumber]: Error httpJsonRPCPOST request:", err)
-		return "", err
+		ID:      nextRequestID(), // match response, debug, support multi-request.
 	}
 
-	resp := &model.ETHBlockNumberResponse{}
-	err = json.Unmarshal(body, resp)
-	if err != nil {
-		log.Println(ctx, "[EthBlockNumber]: Error Unmarshal, err: ", err)
+	var hexNumber string
+	if err := s.call(ctx, request, &hexNumber); err != nil {
+		log.Println(ctx, "[EthBlockNumber]: Error call request:", err)
 		return "", err
 	}
-	hexNumber := resp.Result
-
 	return hexNumber, nil
 }
 
@@ -93,38 +115,90 @@ func (s *ETHRPCService) EthGetBlockByNumber(ctx context.Context, number string)
 		JSONRPC: "2.0",
 		Method:  "eth_getBlockByNumber",
 		Params:  []interface{}{number, true},
-		ID:      84, // match response, debug, support multi-request, should be a uniq random number.
+		ID:      nextRequestID(), // match response, debug, support multi-request.
 	}
 
-	body, err := s.httpJsonRPCPOST(ctx, request)
-	if err != nil {
-		log.Println(ctx, "[EthGetBlockByNumber]: Error httpJsonRPCPOST request:", err)
+	// a nil result is retried by call, the node is often a few ms behind its own eth_blockNumber.
+	blockInfo := &model.ETHBlockInfo{}
+	if err := s.call(ctx, request, blockInfo); err != nil {
+		log.Println(ctx, "[EthGetBlockByNumber]: Error call request:", err, "block number ", number)
 		return nil, err
 	}
-	resp := &model.ETHGetBlockByNumberResponse{}
-	err = json.Unmarshal(body, resp)
-	if err != nil {
-		log.Println(ctx, "[EthGetBlockByNumber]: Error Unmarshal, err: ", err)
+	return blockInfo, nil
+}
+
+// EthGetBlockHeaderByTag returns the header of a block by number or tag, such as "latest", "safe" or "finalized".
+func (s *ETHRPCService) EthGetBlockHeaderByTag(ctx context.Context, tag string) (*model.ETHBlockHeader, error) {
+	request := &model.JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  "eth_getBlockByNumber",
+		Params:  []interface{}{tag, false},
+		ID:      nextRequestID(), // match response, debug, support multi-request.
+	}
+
+	header := &model.ETHBlockHeader{}
+	if err := s.call(ctx, request, header); err != nil {
+		log.Println(ctx, "[EthGetBlockHeaderByTag]: Error call request:", err, "tag ", tag)
 		return nil, err
 	}
-	blockInfo := resp.Result
-	// TODO: if jsonrpc return nil result, retry it.
-	if blockInfo == nil {
-		log.Println(ctx, "[EthGetBlockByNumber]: empty blockInfo, should retry, block number ", number)
-		return nil, errors.New("empty blockInfo")
+	return header, nil
+}
+
+// call send request with retry, circuit breaking and failover, decode its result into result.
+func (s *ETHRPCService) call(ctx context.Context, request *model.JSONRPCRequest, result interface{}) error {
+	tried := map[*endpoint]bool{}
+	return s.withRetry(ctx, request.Method, func() error {
+		return s.do(ctx, tried, func(e *endpoint) error {
+			return s.callOnce(ctx, e, request, result)
+		})
+	})
+}
+
+// callOnce send request once to e, a JSON-RPC error object or a null result is returned as *RPCError.
+func (s *ETHRPCService) callOnce(ctx context.Context, e *endpoint, request *model.JSONRPCRequest, result interface{}) error {
+	body, err := s.httpJsonRPCPOST(ctx, e, request.Method, request)
+	if err != nil {
+		return err
 	}
-	return blockInfo, nil
+	resp := &model.JSONRPCResponse{}
+	if err := json.Unmarshal(body, resp); err != nil {
+		log.Println(ctx, "[callOnce]: Error Unmarshal, err: ", err)
+		return err
+	}
+	if err := responseError(request.Method, resp); err != nil {
+		return err
+	}
+	if len(resp.Result) == 0 || string(resp.Result) == "null" {
+		return newEmptyResultError(request.Method)
+	}
+	return json.Unmarshal(resp.Result, result)
 }
 
-func (s *ETHRPCService) httpJsonRPCPOST(ctx context.Context, request *model.JSONRPCRequest) ([]byte, error) {
-	jsonData, err := json.Marshal(request)
+// Health return breaker state and stats of every endpoint, reported by the service health output.
+func (s *ETHRPCService) Health() *model.RPCHealth {
+	bestHead := atomic.LoadInt64(&s.bestHead)
+	health := &model.RPCHealth{Endpoints: make([]*model.RPCEndpointStats, 0, len(s.endpoints))}
+	for _, e := range s.endpoints {
+		stats := e.stats(bestHead)
+		if stats.Breaker.State == BREAKER_CLOSED && !stats.Lagging {
+			health.Healthy++
+		}
+		health.Endpoints = append(health.Endpoints, stats)
+	}
+	return health
+}
+
+// httpJsonRPCPOST post payload, a single *model.JSONRPCRequest or a batch of them, return raw response body.
+// method name the call in typed errors, transport failures and non-200 statuses are returned as *RPCError.
+func (s *ETHRPCService) httpJsonRPCPOST(ctx context.Context, e *endpoint, method string, payload interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		log.Println(ctx, "[httpJsonRPCPOST]: Error marshaling request:", err)
 		return nil, err
 	}
 
 	// create HTTP POST request
-	req, err := http.NewRequest("POST", s.ethJsonRPCURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Println(ctx, "[httpJsonRPCPOST]: Error creating request:", err)
 		return nil, err
@@ -132,11 +206,14 @@ func (s *ETHRPCService) httpJsonRPCPOST(ctx context.Context, request *model.JSON
 	req.Header.Set("Content-Type", "application/json")
 
 	// HTTP Request
-	client := &http.Client{}
+	client := s.client
+	if client == nil {
+		client = http.DefaultClient
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Println(ctx, "[httpJsonRPCPOST]: Error sending request:", err)
-		return nil, err
+		return nil, newTransportError(method, err)
 	}
 	defer resp.Body.Close()
 
@@ -144,7 +221,16 @@ func (s *ETHRPCService) httpJsonRPCPOST(ctx context.Context, request *model.JSON
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Println(ctx, "[httpJsonRPCPOST]: Error reading response:", err)
-		return nil, err
+		return nil, newTransportError(method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// some providers answer a JSON-RPC error object with a non-200 status, prefer it.
+		single := &model.JSONRPCResponse{}
+		if json.Unmarshal(body, single) == nil && single.Error != nil {
+			return nil, newRPCError(method, single.Error)
+		}
+		log.Println(ctx, "[httpJsonRPCPOST]: Error http status:", resp.StatusCode)
+		return nil, newHTTPStatusError(method, resp.StatusCode, body)
 	}
 
 	return body, nil
@@ -0,0 +1,45 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// callTracerConfig tracer option of debug_traceBlockByHash.
+var callTracerConfig = map[string]interface{}{"tracer": "callTracer"}
+
+// DebugTraceBlocksByHash returns the callTracer call tree of every transaction of blocks hashes in one batch,
+// in the same order. blocks are traced by hash so the traces match the fetched blocks even across a reorg.
+func (s *ETHRPCService) DebugTraceBlocksByHash(ctx context.Context, hashes []string) ([][]*model.ETHTxCallTrace, error) {
+	requests := make([]*model.JSONRPCRequest, len(hashes))
+	traces := make([][]*model.ETHTxCallTrace, len(hashes))
+	results := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		requests[i] = newRequest("debug_traceBlockByHash", hash, callTracerConfig)
+		results[i] = &traces[i]
+	}
+	if err := s.batchDecode(ctx, requests, results); err != nil {
+		log.Println(ctx, "[DebugTraceBlocksByHash]: Error batchDecode, err: ", err)
+		return nil, err
+	}
+	return traces, nil
+}
+
+// TraceBlocks returns the flattened calls of blocks numbers from trace_block in one batch, in the same order.
+func (s *ETHRPCService) TraceBlocks(ctx context.Context, numbers []int64) ([][]*model.ETHParityTrace, error) {
+	requests := make([]*model.JSONRPCRequest, len(numbers))
+	traces := make([][]*model.ETHParityTrace, len(numbers))
+	results := make([]interface{}, len(numbers))
+	for i, number := range numbers {
+		requests[i] = newRequest("trace_block", fmt.Sprintf("0x%x", number))
+		results[i] = &traces[i]
+	}
+	if err := s.batchDecode(ctx, requests, results); err != nil {
+		log.Println(ctx, "[TraceBlocks]: Error batchDecode, err: ", err)
+		return nil, err
+	}
+	return traces, nil
+}
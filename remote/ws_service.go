@@ -0,0 +1,206 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/util"
+)
+
+// ETHWSService ETH JSON-RPC over WebSocket, used for eth_subscribe.
+// a subscription goes to the preferred endpoint and fails over to the others like ETHRPCService.
+type ETHWSService struct {
+	endpoints   []*endpoint
+	dialTimeout time.Duration
+	readTimeout time.Duration // the socket is considered dropped if nothing, not even a pong, arrives for this long.
+}
+
+var (
+	ethWSServiceInstance *ETHWSService
+	ethWSServiceOnce     sync.Once
+)
+
+// ETHWSServiceInstance ETHWSService singleton
+func ETHWSServiceInstance() *ETHWSService {
+	ethWSServiceOnce.Do(func() {
+		urls := util.EnvString("ETHWSURLS", "")
+		if len(urls) == 0 {
+			urls = util.EnvString("ETHWSURL", "")
+		}
+		var endpoints []*endpoint
+		if len(urls) > 0 {
+			var err error
+			endpoints, err = parseEndpoints(urls, func() *circuitBreaker {
+				return newCircuitBreaker(
+					int(util.EnvInt64("RPC_BREAKER_THRESHOLD", 5)),
+					util.EnvDuration("RPC_BREAKER_OPEN_TIMEOUT", 30*time.Second),
+				)
+			})
+			if err != nil {
+				panic(err)
+			}
+		}
+		ethWSServiceInstance = &ETHWSService{
+			endpoints:   endpoints,
+			dialTimeout: util.EnvDuration("WS_DIAL_TIMEOUT", 10*time.Second),
+			readTimeout: util.EnvDuration("WS_READ_TIMEOUT", 60*time.Second),
+		}
+	})
+
+	return ethWSServiceInstance
+}
+
+// HeadsSubscription live newHeads subscription, Err receives once when the socket drops.
+type HeadsSubscription struct {
+	conn      *websocket.Conn
+	endpoint  *endpoint
+	heads     chan *model.ETHBlockHeader
+	err       chan error
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Heads new chain heads, in the order the node announced them.
+func (sub *HeadsSubscription) Heads() <-chan *model.ETHBlockHeader {
+	return sub.heads
+}
+
+// Err receive the error which ended the subscription.
+func (sub *HeadsSubscription) Err() <-chan error {
+	return sub.err
+}
+
+// Close close the socket, Err receives nothing after it.
+func (sub *HeadsSubscription) Close() {
+	sub.closeOnce.Do(func() {
+		close(sub.closed)
+		sub.conn.Close()
+	})
+}
+
+// SubscribeNewHeads subscribe to newHeads on the first endpoint accepting it,
+// endpoints are tried by priority and weight, skipping those with an open breaker.
+func (s *ETHWSService) SubscribeNewHeads(ctx context.Context) (*HeadsSubscription, error) {
+	if len(s.endpoints) == 0 {
+		return nil, errors.New("no ETHWSURL env set")
+	}
+	err := ErrCircuitOpen
+	for _, e := range candidates(s.endpoints) {
+		if e.breaker.Allow() != nil {
+			continue
+		}
+		started := time.Now()
+		var sub *HeadsSubscription
+		sub, err = s.subscribe(ctx, e)
+		e.breaker.Record(err)
+		e.record(time.Since(started), err)
+		if err == nil {
+			return sub, nil
+		}
+		log.Println(ctx, "[SubscribeNewHeads]: endpoint:", e.name(), "Error subscribe, err: ", err)
+	}
+	return nil, err
+}
+
+// subscribe dial endpoint e and subscribe to newHeads.
+func (s *ETHWSService) subscribe(ctx context.Context, e *endpoint) (*HeadsSubscription, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, s.dialTimeout)
+	defer cancel()
+	conn, _, err := websocket.DefaultDialer.DialContext(dialCtx, e.url, nil)
+	if err != nil {
+		log.Println(ctx, "[subscribe]: Error dial, err: ", err)
+		return nil, newTransportError("eth_subscribe", err)
+	}
+
+	request := newRequest("eth_subscribe", "newHeads")
+	conn.SetWriteDeadline(time.Now().Add(s.dialTimeout))
+	if err := conn.WriteJSON(request); err != nil {
+		log.Println(ctx, "[subscribe]: Error write eth_subscribe, err: ", err)
+		conn.Close()
+		return nil, newTransportError(request.Method, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(s.dialTimeout))
+	resp := &model.JSONRPCResponse{}
+	if err := conn.ReadJSON(resp); err != nil {
+		log.Println(ctx, "[subscribe]: Error read eth_subscribe response, err: ", err)
+		conn.Close()
+		return nil, newTransportError(request.Method, err)
+	}
+	if err := responseError(request.Method, resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	sub := &HeadsSubscription{
+		conn:     conn,
+		endpoint: e,
+		heads:    make(chan *model.ETHBlockHeader, 64),
+		err:      make(chan error, 1),
+		closed:   make(chan struct{}),
+	}
+	conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+	})
+	go s.ping(sub)
+	go s.readHeads(ctx, sub)
+	return sub, nil
+}
+
+// ping keep the socket alive and let the read deadline detect a dead peer.
+func (s *ETHWSService) ping(sub *HeadsSubscription) {
+	ticker := time.NewTicker(s.readTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			deadline := time.Now().Add(s.readTimeout / 2)
+			if err := sub.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case <-sub.closed:
+			return
+		}
+	}
+}
+
+// readHeads deliver notifications until the socket fails or is closed.
+func (s *ETHWSService) readHeads(ctx context.Context, sub *HeadsSubscription) {
+	defer close(sub.heads)
+	for {
+		notification := &model.JSONRPCNotification{}
+		if err := sub.conn.ReadJSON(notification); err != nil {
+			select {
+			case <-sub.closed:
+			default:
+				log.Println(ctx, "[readHeads]: endpoint:", sub.endpoint.name(), "Error read notification, err: ", err)
+				err = newTransportError("eth_subscription", err)
+				// a dropped socket counts against the endpoint, the next subscription may fail over.
+				sub.endpoint.breaker.Record(err)
+				sub.err <- err
+				sub.Close()
+			}
+			return
+		}
+		sub.conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+		if notification.Method != "eth_subscription" || notification.Params == nil {
+			continue
+		}
+		header := &model.ETHBlockHeader{}
+		if err := json.Unmarshal(notification.Params.Result, header); err != nil {
+			log.Println(ctx, "[readHeads]: Error Unmarshal header, err: ", err)
+			continue
+		}
+		select {
+		case sub.heads <- header:
+		case <-sub.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+// newHeadsTestServer accept eth_subscribe, push heads then drop the socket.
+func newHeadsTestServer(t *testing.T, heads []string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		assert.Nil(t, err)
+		defer conn.Close()
+		request := &model.JSONRPCRequest{}
+		assert.Nil(t, conn.ReadJSON(request))
+		assert.Equal(t, "eth_subscribe", request.Method)
+		assert.Equal(t, "newHeads", request.Params[0])
+		conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": "0xabc"})
+		for _, head := range heads {
+			conn.WriteJSON(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "eth_subscription",
+				"params":  map[string]interface{}{"subscription": "0xabc", "result": map[string]interface{}{"number": head}},
+			})
+		}
+	}))
+}
+
+func TestWSService_SubscribeNewHeads(t *testing.T) {
+	ctx := context.Background()
+	server := newHeadsTestServer(t, []string{"0x10", "0x11"})
+	defer server.Close()
+	s := &ETHWSService{
+		endpoints:   []*endpoint{newEndpoint("ws"+strings.TrimPrefix(server.URL, "http"), 0, 1, nil)},
+		dialTimeout: time.Second,
+		readTimeout: time.Second,
+	}
+
+	sub, err := s.SubscribeNewHeads(ctx)
+	assert.Nil(t, err)
+	defer sub.Close()
+	numbers := []string{}
+	for header := range sub.Heads() {
+		numbers = append(numbers, header.Number)
+	}
+	assert.Equal(t, []string{"0x10", "0x11"}, numbers)
+
+	// the server dropped the socket.
+	select {
+	case err := <-sub.Err():
+		assert.True(t, errors.Is(err, ErrUpstreamUnavailable))
+	case <-time.After(time.Second):
+		t.Fatal("no subscription error")
+	}
+}
+
+func TestWSService_SubscribeRejected(t *testing.T) {
+	ctx := context.Background()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _ := upgrader.Upgrade(w, r, nil)
+		defer conn.Close()
+		request := &model.JSONRPCRequest{}
+		conn.ReadJSON(request)
+		conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "error": map[string]interface{}{"code": -32601, "message": "the method eth_subscribe does not exist"}})
+	}))
+	defer server.Close()
+	s := &ETHWSService{endpoints: []*endpoint{newEndpoint("ws"+strings.TrimPrefix(server.URL, "http"), 0, 1, nil)}, dialTimeout: time.Second, readTimeout: time.Second}
+
+	_, err := s.SubscribeNewHeads(ctx)
+	assert.True(t, errors.Is(err, ErrMethodNotFound))
+
+	_, err = (&ETHWSService{}).SubscribeNewHeads(ctx)
+	assert.NotNil(t, err)
+}
+
+func TestWSService_SubscribeFailover(t *testing.T) {
+	ctx := context.Background()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	backup := newHeadsTestServer(t, []string{"0x10"})
+	defer backup.Close()
+	primary := newEndpoint("ws"+strings.TrimPrefix(down.URL, "http"), 0, 1, newCircuitBreaker(1, time.Minute))
+	s := &ETHWSService{
+		endpoints: []*endpoint{
+			newEndpoint("ws"+strings.TrimPrefix(backup.URL, "http"), 1, 1, newCircuitBreaker(1, time.Minute)),
+			primary,
+		},
+		dialTimeout: time.Second,
+		readTimeout: time.Second,
+	}
+
+	// the preferred endpoint is down, the backup serves the subscription.
+	sub, err := s.SubscribeNewHeads(ctx)
+	assert.Nil(t, err)
+	defer sub.Close()
+	header := <-sub.Heads()
+	assert.Equal(t, "0x10", header.Number)
+	assert.Equal(t, BREAKER_OPEN, primary.breaker.State().State)
+	// the backup dropped the socket, its breaker opens too and nothing is left to try.
+	<-sub.Err()
+	_, err = s.SubscribeNewHeads(ctx)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/remote"
+	"github.com/sugarshop/token-gateway/storage"
+)
+
+// backfillBlockRetry how many times a failed block is fetched again before the job fails.
+const backfillBlockRetry = 3
+
+// backfillRunner keep backfill jobs of this process and their runtime progress.
+type backfillRunner struct {
+	mutex sync.RWMutex
+	jobs  map[string]*model.ETHBackfillJob
+}
+
+func newBackfillRunner() *backfillRunner {
+	return &backfillRunner{jobs: map[string]*model.ETHBackfillJob{}}
+}
+
+// get return a copy of job id, so callers never race with the job goroutine.
+func (r *backfillRunner) get(id string) (*model.ETHBackfillJob, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	saved := *job
+	return &saved, true
+}
+
+// list return copies of jobs of address, all jobs if address is empty.
+func (r *backfillRunner) list(address string) []*model.ETHBackfillJob {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	jobs := make([]*model.ETHBackfillJob, 0)
+	for _, job := range r.jobs {
+		if len(address) == 0 || string(job.Address) == address {
+			saved := *job
+			jobs = append(jobs, &saved)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// update apply fn to job id under lock and return a copy of the result.
+func (r *backfillRunner) update(id string, fn func(job *model.ETHBackfillJob)) *model.ETHBackfillJob {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	job := r.jobs[id]
+	fn(job)
+	job.UpdatedAt = time.Now().Unix()
+	saved := *job
+	return &saved
+}
+
+// startBackfill create and run a job scanning blocks [fromBlock, toBlock] for address.
+func (s *ETHService) startBackfill(ctx context.Context, address string, fromBlock, toBlock int64) (*model.ETHBackfillJob, error) {
+	if fromBlock < 0 || fromBlock > toBlock {
+		return nil, fmt.Errorf("invalid backfill range [%d, %d]", fromBlock, toBlock)
+	}
+	now := time.Now()
+	job := &model.ETHBackfillJob{
+		ID:           fmt.Sprintf("%019d", now.UnixNano()),
+		Address:      model.Address(address),
+		FromBlock:    fromBlock,
+		ToBlock:      toBlock,
+		CurrentBlock: fromBlock - 1,
+		Status:       model.BACKFILL_STATUS_RUNNING,
+		CreatedAt:    now.Unix(),
+		UpdatedAt:    now.Unix(),
+	}
+	if err := s.store.PutBackfillJob(ctx, job); err != nil {
+		log.Println(ctx, "[startBackfill]: Error PutBackfillJob, err: ", err)
+		return nil, err
+	}
+	s.backfills.mutex.Lock()
+	s.backfills.jobs[job.ID] = job
+	s.backfills.mutex.Unlock()
+	saved := *job
+	go s.runBackfill(context.Background(), job.ID)
+	return &saved, nil
+}
+
+// resumeBackfills restart jobs still running when the process stopped.
+func (s *ETHService) resumeBackfills(ctx context.Context) error {
+	jobs, err := s.store.ListBackfillJobs(ctx)
+	if err != nil {
+		log.Println(ctx, "[resumeBackfills]: Error ListBackfillJobs, err: ", err)
+		return err
+	}
+	s.backfills.mutex.Lock()
+	for _, job := range jobs {
+		s.backfills.jobs[job.ID] = job
+	}
+	s.backfills.mutex.Unlock()
+	for _, job := range jobs {
+		if job.Status == model.BACKFILL_STATUS_RUNNING {
+			log.Println(ctx, "[resumeBackfills]: resume backfill job:", job.ID, "address:", job.Address, "block:", job.CurrentBlock+1)
+			go s.runBackfill(ctx, job.ID)
+		}
+	}
+	return nil
+}
+
+// runBackfill scan the remaining blocks of job id in order, persist progress after every block.
+func (s *ETHService) runBackfill(ctx context.Context, id string) {
+	job, _ := s.backfills.get(id)
+	started := time.Now()
+	startBlock := job.CurrentBlock + 1
+	fetcher := s.fetcher.withFetch(s.fetchBlocksWithRetry)
+	err := fetcher.Fetch(ctx, startBlock, job.ToBlock, func(number int64, blockInfo *model.ETHBlockInfo) error {
+		found, transfers, err := s.backfillBlock(ctx, string(job.Address), blockInfo)
+		if err != nil {
+			return err
+		}
+		scanned := number - startBlock + 1
+		progress := s.backfills.update(id, func(job *model.ETHBackfillJob) {
+			job.CurrentBlock = number
+			job.Transactions += int64(found)
+			job.Transfers += int64(transfers)
+			job.Progress = float64(number-job.FromBlock+1) / float64(job.ToBlock-job.FromBlock+1)
+			perBlock := time.Since(started) / time.Duration(scanned)
+			job.ETASeconds = int64((perBlock * time.Duration(job.ToBlock-number)).Seconds())
+			if number == job.ToBlock {
+				job.Status = model.BACKFILL_STATUS_COMPLETED
+				job.FinishedAt = time.Now().Unix()
+			}
+		})
+		if err := s.store.PutBackfillJob(ctx, progress); err != nil {
+			log.Println(ctx, "[runBackfill]: Error PutBackfillJob, err: ", err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(ctx, "[runBackfill]: job:", id, "Error Fetch, err: ", err)
+		failed := s.backfills.update(id, func(job *model.ETHBackfillJob) {
+			job.Status = model.BACKFILL_STATUS_FAILED
+			job.Error = err.Error()
+			job.ETASeconds = 0
+			job.FinishedAt = time.Now().Unix()
+		})
+		if err := s.store.PutBackfillJob(ctx, failed); err != nil {
+			log.Println(ctx, "[runBackfill]: Error PutBackfillJob, err: ", err)
+		}
+		return
+	}
+	log.Println(ctx, "[runBackfill]: job:", id, "completed, address:", job.Address)
+}
+
+// fetchBlocksWithRetry fetch blocks, retry a few times since a backfill job fails on the first lost block.
+func (s *ETHService) fetchBlocksWithRetry(ctx context.Context, numbers []int64) ([]*model.ETHBlockInfo, error) {
+	var blocks []*model.ETHBlockInfo
+	var err error
+	for i := 0; i < backfillBlockRetry; i++ {
+		blocks, err = s.fetchBlocks(ctx, numbers)
+		if err == nil || !remote.IsRetryable(err) {
+			return blocks, err
+		}
+		select {
+		case <-time.After(time.Duration(i+1) * time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
+
+// backfillBlock store transactions, token and internal transfers and withdrawals of blockInfo involving address,
+// return how many transactions and transfers were found.
+// a block inside the reorg window gets address registered on it, so a rollback removes the backfilled rows too.
+func (s *ETHService) backfillBlock(ctx context.Context, address string, blockInfo *model.ETHBlockInfo) (int, int, error) {
+	s.ingestMutex.Lock()
+	defer s.ingestMutex.Unlock()
+	s.addrRWMutex.RLock()
+	_, ok := s.subAddrs[address]
+	s.addrRWMutex.RUnlock()
+	if !ok {
+		// unsubscribed while the job was running, stop writing its history.
+		return 0, 0, errUnsubscribed
+	}
+	number := int64(blockInfo.Number)
+	if number > atomic.LoadInt64(&s.recentBlockNumer) {
+		// not applied yet, live ingestion writes it with address already subscribed.
+		return 0, 0, nil
+	}
+	applied := s.window.Find(number)
+	if applied != nil && applied.hash != string(blockInfo.Hash) {
+		// the chain moved since the block was applied, the rollback and re-ingest cover address.
+		log.Println(ctx, "[backfillBlock]: skip block:", number, "fetched:", blockInfo.Hash, "applied:", applied.hash)
+		return 0, 0, nil
+	}
+	// resolve deployed contracts first, a contract's history starts with its creation like live ingestion.
+	creations := make([]*model.ETHTransaction, 0)
+	for _, tx := range blockInfo.Transactions {
+		if isContractCreation(tx) {
+			creations = append(creations, tx)
+		}
+	}
+	if len(creations) > 0 {
+		if err := attachReceipts(ctx, s.receipts, creations); err != nil {
+			return 0, 0, err
+		}
+		markContractCreations(creations)
+	}
+	addrs := map[string]bool{address: true}
+	txs := make([]*model.ETHTransaction, 0)
+	for _, tx := range blockInfo.Transactions {
+		if len(matchAddresses(addrs, tx)) > 0 {
+			txs = append(txs, tx)
+		}
+	}
+	batch := map[string][]*model.ETHTransaction{}
+	if len(txs) > 0 {
+		if err := attachReceipts(ctx, s.receipts, txs); err != nil {
+			return 0, 0, err
+		}
+		markContractCreations(txs)
+		batch[address] = txs
+	}
+	subscribed := func(addr string) bool {
+		return addr == address
+	}
+	transfers := tokenTransferBatch(blockInfo, subscribed)
+	internals := internalTransferBatch(blockInfo, subscribed)
+	withdrawals := withdrawalBatch(blockInfo, subscribed)
+	records := &storage.BlockBatch{
+		Transactions:      batch,
+		TokenTransfers:    transfers,
+		InternalTransfers: internals,
+		Withdrawals:       withdrawals,
+	}
+	if !records.Empty() {
+		if err := s.store.AppendBlock(ctx, records); err != nil {
+			return 0, 0, err
+		}
+	}
+	found := len(transfers[address]) + len(internals[address]) + len(withdrawals[address])
+	if applied != nil && len(txs)+found > 0 {
+		applied.addrs = appendMissing(applied.addrs, address)
+	}
+	return len(txs), found, nil
+}
+
+// GetBackfillJob get backfill job status by id.
+func (s *ETHService) GetBackfillJob(ctx context.Context, id string) (*model.ETHBackfillJob, error) {
+	job, ok := s.backfills.get(id)
+	if !ok {
+		return nil, errors.New("backfill job not found")
+	}
+	return job, nil
+}
+
+// ListBackfillJobs list backfill jobs of address, all jobs if address is empty.
+func (s *ETHService) ListBackfillJobs(ctx context.Context, address string) ([]*model.ETHBackfillJob, error) {
+	return s.backfills.list(address), nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/storage"
+	"github.com/tj/assert"
+)
+
+func TestETHService_SubscribeWhileIngesting(t *testing.T) {
+	ctx := context.Background()
+	const addr = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	s := &ETHService{
+		subAddrs:         map[string]bool{},
+		store:            storage.NewMemoryStorage(""),
+		window:           newBlockWindow(8),
+		recentBlockNumer: 10,
+	}
+	blockInfo := &model.ETHBlockInfo{Hash: "0xb", Number: 0xb, Transactions: []*model.ETHTransaction{{Hash: "0x2", BlockHash: "0xb", BlockNumber: 0xb, To: addr}}}
+
+	// block 11 is being applied when the subscription comes in.
+	s.ingestMutex.Lock()
+	done := make(chan error)
+	go func() {
+		_, err := s.SubscribeFrom(ctx, &model.ETHSubscribeRequest{Address: addr, FromBlock: -1})
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	addrs, err := s.writeBlock(ctx, blockInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(addrs))
+	assert.Nil(t, s.saveCursor(ctx, 11))
+	s.ingestMutex.Unlock()
+	assert.Nil(t, <-done)
+
+	// block 11 was applied without address, its backfill range must cover it.
+	subs, err := s.store.ListSubscriptions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(subs))
+	assert.Equal(t, int64(12), subs[0].StartBlock)
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/remote"
+)
+
+// fetchBlocksFunc fetch blocks by number, returned in the same order.
+type fetchBlocksFunc func(ctx context.Context, numbers []int64) ([]*model.ETHBlockInfo, error)
+
+// applyBlockFunc consume one fetched block, returning an error stops the range.
+type applyBlockFunc func(number int64, blockInfo *model.ETHBlockInfo) error
+
+// blockResult outcome of one chunk fetch.
+type blockResult struct {
+	blocks []*model.ETHBlockInfo
+	err    error
+}
+
+// fetchJob one chunk of consecutive blocks to fetch, the worker delivers the outcome to result.
+type fetchJob struct {
+	numbers []int64
+	result  chan *blockResult
+}
+
+// blockFetcher fetch a range of blocks with a bounded worker pool and apply them strictly in block order.
+// every worker request fetches a chunk of batchSize blocks with one JSON-RPC batch.
+// inflight is shared by every range, it caps concurrent requests to the RPC provider for the whole service.
+type blockFetcher struct {
+	concurrency int           // workers per range.
+	batchSize   int           // blocks per request.
+	inflight    chan struct{} // global in-flight request slots.
+	fetch       fetchBlocksFunc
+}
+
+// newBlockFetcher return fetcher with concurrency workers per range and at most maxInFlight requests at a time.
+func newBlockFetcher(concurrency, maxInFlight, batchSize int, fetch fetchBlocksFunc) *blockFetcher {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if maxInFlight <= 0 {
+		maxInFlight = concurrency
+	}
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	return &blockFetcher{
+		concurrency: concurrency,
+		batchSize:   batchSize,
+		inflight:    make(chan struct{}, maxInFlight),
+		fetch:       fetch,
+	}
+}
+
+// withFetch return a fetcher using fetch, sharing the in-flight slots of f.
+func (f *blockFetcher) withFetch(fetch fetchBlocksFunc) *blockFetcher {
+	return &blockFetcher{
+		concurrency: f.concurrency,
+		batchSize:   f.batchSize,
+		inflight:    f.inflight,
+		fetch:       fetch,
+	}
+}
+
+// fetchBlocksByNumber default fetchBlocksFunc calling eth_getBlockByNumber and eth_getLogs for token events in one batch.
+func fetchBlocksByNumber(ctx context.Context, numbers []int64) ([]*model.ETHBlockInfo, error) {
+	blocks, err := remote.ETHRPCServiceInstance().EthGetBlocksWithLogs(ctx, numbers, tokenEventTopics)
+	if err != nil {
+		return nil, err
+	}
+	checkTransactions(ctx, blocks)
+	return blocks, nil
+}
+
+// checkTransactions log transactions missing the fields their type requires,
+// they are kept since a provider leaving out a field must not halt ingestion.
+func checkTransactions(ctx context.Context, blocks []*model.ETHBlockInfo) {
+	for _, blockInfo := range blocks {
+		for _, tx := range blockInfo.Transactions {
+			if err := tx.Validate(); err != nil {
+				log.Println(ctx, "[checkTransactions]: block:", blockInfo.Number, "keep invalid transaction, err: ", err)
+			}
+		}
+	}
+}
+
+// Fetch fetch blocks [from, to] concurrently, apply is called in block order from the calling goroutine.
+// the first fetch or apply error stops the range and is returned, blocks after it are not applied.
+func (f *blockFetcher) Fetch(ctx context.Context, from, to int64, apply applyBlockFunc) error {
+	if from > to {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// ordered keep jobs in block order, its capacity bounds
+	// how far workers may run ahead of the block being applied.
+	ordered := make(chan *fetchJob, f.concurrency*2)
+	jobs := make(chan *fetchJob)
+
+	// producer: enqueue chunks in order.
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		for start := from; start <= to; start += int64(f.batchSize) {
+			numbers := make([]int64, 0, f.batchSize)
+			for number := start; number <= to && number < start+int64(f.batchSize); number++ {
+				numbers = append(numbers, number)
+			}
+			job := &fetchJob{numbers: numbers, result: make(chan *blockResult, 1)}
+			select {
+			case ordered <- job:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// workers: fetch chunks, at most concurrency per range and len(inflight) for the whole service.
+	for i := 0; i < f.concurrency; i++ {
+		go func() {
+			for job := range jobs {
+				select {
+				case f.inflight <- struct{}{}:
+				case <-ctx.Done():
+					job.result <- &blockResult{err: ctx.Err()}
+					continue
+				}
+				blocks, err := f.fetch(ctx, job.numbers)
+				<-f.inflight
+				if err == nil && len(blocks) != len(job.numbers) {
+					err = errors.New("fetched blocks count mismatch")
+				}
+				job.result <- &blockResult{blocks: blocks, err: err}
+			}
+		}()
+	}
+
+	// consumer: apply in block order.
+	for job := range ordered {
+		var result *blockResult
+		select {
+		case result = <-job.result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if result.err != nil {
+			log.Println(ctx, "[blockFetcher.Fetch]: Error fetch blocks from:", job.numbers[0], "err: ", result.err)
+			return result.err
+		}
+		for i, blockInfo := range result.blocks {
+			if err := apply(job.numbers[i], blockInfo); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
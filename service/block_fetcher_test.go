@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+func TestBlockFetcher_Fetch(t *testing.T) {
+	ctx := context.Background()
+	var inflight, maxInflight int64
+	fetcher := newBlockFetcher(4, 3, 5, func(ctx context.Context, numbers []int64) ([]*model.ETHBlockInfo, error) {
+		n := atomic.AddInt64(&inflight, 1)
+		for {
+			max := atomic.LoadInt64(&maxInflight)
+			if n <= max || atomic.CompareAndSwapInt64(&maxInflight, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		atomic.AddInt64(&inflight, -1)
+		blocks := make([]*model.ETHBlockInfo, 0, len(numbers))
+		for _, number := range numbers {
+			blocks = append(blocks, &model.ETHBlockInfo{Number: model.Uint64(number)})
+		}
+		return blocks, nil
+	})
+
+	applied := []int64{}
+	err := fetcher.Fetch(ctx, 100, 150, func(number int64, blockInfo *model.ETHBlockInfo) error {
+		assert.Equal(t, model.Uint64(number), blockInfo.Number)
+		applied = append(applied, number)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 51, len(applied))
+	for i, number := range applied {
+		assert.Equal(t, int64(100+i), number)
+	}
+	assert.Condition(t, func() bool {
+		return atomic.LoadInt64(&maxInflight) <= 3
+	})
+}
+
+func TestBlockFetcher_FetchStopOnError(t *testing.T) {
+	ctx := context.Background()
+	errFetch := errors.New("fetch failed")
+	fetcher := newBlockFetcher(4, 4, 5, func(ctx context.Context, numbers []int64) ([]*model.ETHBlockInfo, error) {
+		if numbers[0] == 105 {
+			return nil, errFetch
+		}
+		blocks := make([]*model.ETHBlockInfo, len(numbers))
+		for i := range blocks {
+			blocks[i] = &model.ETHBlockInfo{}
+		}
+		return blocks, nil
+	})
+	applied := []int64{}
+	err := fetcher.Fetch(ctx, 100, 200, func(number int64, blockInfo *model.ETHBlockInfo) error {
+		applied = append(applied, number)
+		return nil
+	})
+	assert.Equal(t, errFetch, err)
+	assert.Equal(t, []int64{100, 101, 102, 103, 104}, applied)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/remote"
+	"github.com/sugarshop/token-gateway/util"
+)
+
+// setHead record the chain head observed by the ingest loop.
+func (s *ETHService) setHead(number int64) {
+	atomic.StoreInt64(&s.headBlockNumber, number)
+}
+
+// refreshFinalized query the finalized block, keep the previous value on error.
+func (s *ETHService) refreshFinalized(ctx context.Context) {
+	header, err := remote.ETHRPCServiceInstance().EthGetBlockHeaderByTag(ctx, "finalized")
+	if err != nil {
+		log.Println(ctx, "[refreshFinalized]: Error EthGetBlockHeaderByTag, err: ", err)
+		return
+	}
+	num, err := util.ParseHexInt64(header.Number)
+	if err != nil {
+		log.Println(ctx, "[refreshFinalized]: Error ParseHexInt64, err: ", err)
+		return
+	}
+	atomic.StoreInt64(&s.finalizedBlockNumber, num)
+}
+
+// txStatus return confirmation count and settlement status of a transaction included at blockNumber.
+func (s *ETHService) txStatus(blockNumber int64) (int64, string) {
+	head := atomic.LoadInt64(&s.headBlockNumber)
+	finalized := atomic.LoadInt64(&s.finalizedBlockNumber)
+	confirmations := head - blockNumber + 1
+	if confirmations < 0 {
+		confirmations = 0
+	}
+	switch {
+	case finalized > 0 && blockNumber <= finalized:
+		return confirmations, model.TX_STATUS_FINALIZED
+	case confirmations >= s.confirmationBlocks:
+		return confirmations, model.TX_STATUS_CONFIRMED
+	default:
+		return confirmations, model.TX_STATUS_PENDING_CONFIRMATION
+	}
+}
+
+// withStatus annotate transactions with confirmation count and settlement status.
+func (s *ETHService) withStatus(ctx context.Context, transactions []*model.ETHTransaction) []*model.ETHTransactionWithStatus {
+	list := make([]*model.ETHTransactionWithStatus, 0, len(transactions))
+	for _, tx := range transactions {
+		item := &model.ETHTransactionWithStatus{
+			ETHTransaction: tx,
+			Status:         model.TX_STATUS_PENDING_CONFIRMATION,
+		}
+		item.Confirmations, item.Status = s.txStatus(int64(tx.BlockNumber))
+		list = append(list, item)
+	}
+	return list
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+func TestETHService_WithStatus(t *testing.T) {
+	ctx := context.Background()
+	s := &ETHService{confirmationBlocks: 12}
+	s.setHead(0x110)
+	s.finalizedBlockNumber = 0x100
+	list := s.withStatus(ctx, []*model.ETHTransaction{
+		{Hash: "0x1", BlockNumber: 0x100},
+		{Hash: "0x2", BlockNumber: 0x105},
+		{Hash: "0x3", BlockNumber: 0x10a},
+	})
+	assert.Equal(t, 3, len(list))
+	assert.Equal(t, int64(17), list[0].Confirmations)
+	assert.Equal(t, model.TX_STATUS_FINALIZED, list[0].Status)
+	assert.Equal(t, int64(12), list[1].Confirmations)
+	assert.Equal(t, model.TX_STATUS_CONFIRMED, list[1].Status)
+	assert.Equal(t, int64(7), list[2].Confirmations)
+	assert.Equal(t, model.TX_STATUS_PENDING_CONFIRMATION, list[2].Status)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// isContractCreation report whether tx deploys a contract, its recipient is null.
+func isContractCreation(tx *model.ETHTransaction) bool {
+	return len(tx.To) == 0
+}
+
+// markContractCreations set the deployed contract address of creations whose receipt is attached,
+// a reverted creation deploys nothing.
+func markContractCreations(txs []*model.ETHTransaction) {
+	for _, tx := range txs {
+		if !isContractCreation(tx) || tx.Receipt == nil || tx.Receipt.Status == model.RECEIPT_STATUS_FAILED {
+			continue
+		}
+		tx.ContractCreated = tx.Receipt.ContractAddress
+	}
+}
+
+// subscribeDeployedContracts subscribe contracts deployed in blockInfo by subscribed addresses,
+// before the block is matched so the contract's own activity in the block is captured too.
+// a reorg does not undo the subscription, the same deployer and nonce deploy to the same address.
+func (s *ETHService) subscribeDeployedContracts(ctx context.Context, blockInfo *model.ETHBlockInfo) error {
+	creations := make([]*model.ETHTransaction, 0)
+	s.addrRWMutex.RLock()
+	for _, tx := range blockInfo.Transactions {
+		if isContractCreation(tx) && s.subAddrs[string(tx.From)] {
+			creations = append(creations, tx)
+		}
+	}
+	s.addrRWMutex.RUnlock()
+	if len(creations) == 0 {
+		return nil
+	}
+	if err := attachReceipts(ctx, s.receipts, creations); err != nil {
+		log.Println(ctx, "[subscribeDeployedContracts]: Error attachReceipts, err: ", err)
+		return err
+	}
+	markContractCreations(creations)
+	for _, tx := range creations {
+		if len(tx.ContractCreated) == 0 {
+			continue
+		}
+		s.addrRWMutex.RLock()
+		subscribed := s.subAddrs[string(tx.ContractCreated)]
+		s.addrRWMutex.RUnlock()
+		if subscribed {
+			continue
+		}
+		sub := &model.ETHSubscription{
+			Address:    tx.ContractCreated,
+			CreatedAt:  time.Now().Unix(),
+			StartBlock: int64(blockInfo.Number),
+			Deployer:   tx.From,
+		}
+		if err := s.store.PutSubscription(ctx, sub); err != nil {
+			log.Println(ctx, "[subscribeDeployedContracts]: Error PutSubscription, err: ", err)
+			return err
+		}
+		s.addrRWMutex.Lock()
+		s.subAddrs[string(sub.Address)] = true
+		s.addrRWMutex.Unlock()
+		log.Println(ctx, "[subscribeDeployedContracts]: subscribed contract:", sub.Address, "deployer:", sub.Deployer)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/storage"
+	"github.com/tj/assert"
+)
+
+func TestETHService_ApplyBlock_ContractCreation(t *testing.T) {
+	ctx := context.Background()
+	const (
+		deployer = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+		contract = "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+		other    = "0x70997970c51812dc3a010c7d01b50e0d17dc79c8"
+	)
+	blockInfo := &model.ETHBlockInfo{Number: 0xa, Hash: "0xa", Transactions: []*model.ETHTransaction{
+		{Hash: "0x1", BlockHash: "0xa", BlockNumber: 0xa, From: deployer},
+		{Hash: "0x2", BlockHash: "0xa", BlockNumber: 0xa, From: deployer},
+		{Hash: "0x3", BlockHash: "0xa", BlockNumber: 0xa, From: other, To: contract},
+	}}
+	fetch := func(ctx context.Context, hashes []string) ([]*model.ETHTransactionReceipt, error) {
+		receipts := make([]*model.ETHTransactionReceipt, len(hashes))
+		for i, hash := range hashes {
+			status := model.Uint64(1)
+			receipts[i] = &model.ETHTransactionReceipt{TransactionHash: model.Hash(hash), BlockHash: "0xa", Status: &status}
+			switch hash {
+			case "0x1":
+				receipts[i].ContractAddress = contract
+			case "0x2":
+				// reverted creation, the node still reports the would-be address.
+				receipts[i].ContractAddress = "0xe7f1725e7734ce288f8367e1bb143e90bb3f0512"
+				status = 0
+			}
+		}
+		return receipts, nil
+	}
+
+	for _, auto := range []bool{false, true} {
+		s := &ETHService{
+			subAddrs:               map[string]bool{deployer: true},
+			store:                  storage.NewMemoryStorage(""),
+			receipts:               fetch,
+			autoSubscribeContracts: auto,
+		}
+		for _, tx := range blockInfo.Transactions {
+			tx.Receipt, tx.ContractCreated = nil, ""
+		}
+		_, err := s.applyBlock(ctx, blockInfo)
+		assert.Nil(t, err)
+		list, err := s.store.GetTransactions(ctx, deployer)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(list))
+		assert.Equal(t, model.Address(contract), list[0].ContractCreated)
+		assert.Equal(t, model.Address(""), list[1].ContractCreated)
+
+		subs, err := s.store.ListSubscriptions(ctx)
+		assert.Nil(t, err)
+		list, err = s.store.GetTransactions(ctx, contract)
+		assert.Nil(t, err)
+		if !auto {
+			assert.Equal(t, 0, len(subs))
+			assert.Equal(t, 0, len(list))
+			continue
+		}
+		assert.Equal(t, 1, len(subs))
+		assert.Equal(t, model.Address(contract), subs[0].Address)
+		assert.Equal(t, model.Address(deployer), subs[0].Deployer)
+		assert.Equal(t, int64(10), subs[0].StartBlock)
+		// the creation and the call made in the same block.
+		assert.Equal(t, 2, len(list))
+		assert.Equal(t, model.Hash("0x1"), list[0].Hash)
+		assert.Equal(t, model.Hash("0x3"), list[1].Hash)
+	}
+}
@@ -2,23 +2,44 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sugarshop/token-gateway/model"
 	"github.com/sugarshop/token-gateway/remote"
+	"github.com/sugarshop/token-gateway/storage"
+	"github.com/sugarshop/token-gateway/util"
 )
 
 // ETHService ETH Transactions data parser service.
 type ETHService struct {
-	recentBlockNumer int64 // the most recent block number I have ever oberve.
+	// int64 fields accessed atomically come first to keep 64-bit alignment.
+	headBlockNumber int64 // the most recent block number of the chain.
+	finalizedBlockNumber int64 // the most recent finalized block number.
+	confirmationBlocks int64 // blocks required before a transaction is confirmed.
+	recentBlockNumer int64 // the most recent block number I have fully parsed.
+	store storage.Storage // subscriptions, transactions and cursor, resume from it after restart.
 	addrRWMutex sync.RWMutex
-	subAddrs map[string]bool
-	txRWMutex sync.RWMutex
-	transactions map[string][]*model.ETHTransaction
+	subAddrs map[string]bool // in-memory index of stored subscriptions, checked for every transaction.
+	window *blockWindow // recent applied blocks, used to detect reorg.
+	reorg *model.ETHReorgEvent // reorg being rolled back, kept across ticks until the canonical branch is applied, guarded by ingestMutex.
+	reorgs *reorgLog
+	backfills *backfillRunner
+	ingestMutex sync.Mutex // held while a block is applied or backfilled, so unsubscribe and bulk subscribe never race a block write.
+	fetcher *blockFetcher // concurrent ordered block fetching for catch-up.
+	transport atomic.Value // TRANSPORT_* currently driving ingestion.
+	traceMode string // model.TRACE_MODE_*, parse internal transfers with a tracer if set.
+	receipts fetchReceiptsFunc // receipts of matched transactions.
+	autoSubscribeContracts bool // subscribe contracts deployed by subscribed addresses.
+	bulkSubscribeLimit int // most addresses accepted by one bulk subscribe.
+	streams *txHub // open transaction streams, fed by applyBlock.
+	streamHeartbeat time.Duration // idle interval between stream keep-alives.
+	pushes *pushHub // open push socket connections, fed by the ingest loop.
 }
 
 var (
@@ -29,27 +50,69 @@ var (
 // ETHServiceInstance ETHService singleton
 func ETHServiceInstance() *ETHService {
 	eTHServiceOnce.Do(func() {
+		ctx := context.Background()
+		store, err := storage.New(&storage.Config{
+			Backend:    util.EnvString("STORAGE", storage.BACKEND_MEMORY),
+			Path:       util.EnvString("STORAGE_PATH", "data/token-gateway.db"),
+			CursorFile: util.EnvString("CURSOR_FILE", ""),
+		})
+		if err != nil {
+			log.Panicln(ctx, "[ETHServiceInstance]: Panic, Error storage New, err: ", err)
+		}
+		confirmationBlocks := util.EnvInt64("CONFIRMATION_BLOCKS", 12)
 		eTHServiceInstance = &ETHService{
 			subAddrs:   map[string]bool{},
-			transactions:  map[string][]*model.ETHTransaction{},
+			store: store,
+			window: newBlockWindow(reorgWindowSize(util.EnvInt64("REORG_WINDOW", 64), confirmationBlocks)),
+			reorgs: &reorgLog{},
+			backfills: newBackfillRunner(),
+			confirmationBlocks: confirmationBlocks,
+			traceMode: util.EnvString("TRACE_MODE", model.TRACE_MODE_OFF),
+			receipts: fetchReceipts,
+			autoSubscribeContracts: util.EnvBool("AUTO_SUBSCRIBE_CONTRACTS", false),
+			bulkSubscribeLimit: int(util.EnvInt64("BULK_SUBSCRIBE_LIMIT", 10000)),
+			streams: newTxHub(int(util.EnvInt64("STREAM_BUFFER", 64))),
+			streamHeartbeat: util.EnvDuration("STREAM_HEARTBEAT_INTERVAL", 15*time.Second),
+			pushes: newPushHub(
+				int(util.EnvInt64("PUSH_BUFFER", 256)),
+				int(util.EnvInt64("PUSH_MAX_CONNECTIONS", 1000)),
+				int(util.EnvInt64("PUSH_MAX_TOPICS", 100)),
+			),
 		}
-		ctx := context.Background()
-		dec, err := remote.ETHRPCServiceInstance().ETHBlockDecimalNumber(ctx)
+		eTHServiceInstance.fetcher = newBlockFetcher(
+			int(util.EnvInt64("FETCH_CONCURRENCY", 4)),
+			int(util.EnvInt64("FETCH_MAX_INFLIGHT", 8)),
+			int(util.EnvInt64("FETCH_BATCH_SIZE", 10)),
+			eTHServiceInstance.fetchBlocks,
+		)
+		subs, err := store.ListSubscriptions(ctx)
+		if err != nil {
+			log.Panicln(ctx, "[ETHServiceInstance]: Panic, Error ListSubscriptions, err: ", err)
+		}
+		for _, sub := range subs {
+			eTHServiceInstance.subAddrs[string(sub.Address)] = true
+		}
+		num, ok, err := store.LoadCursor(ctx)
 		if err != nil {
-			log.Panicln(ctx, "[ETHServiceInstance]: Panic, Error ETHBlockDecimalNumber, err: ", err)
-		}
-		eTHServiceInstance.recentBlockNumer = dec
-
-		go func() {
-			// query eth block number per second.
-			// if new block number appear, getBlockByNumber.
-			// parse tx into inbount/outbound.
-			for range time.Tick(1 * time.Second) {
-				if err := eTHServiceInstance.load(ctx); err != nil {
-					log.Println(ctx, "[ETHServiceInstance]: eTHServiceInstance load err: ", err)
-				}
+			log.Panicln(ctx, "[ETHServiceInstance]: Panic, Error LoadCursor, err: ", err)
+		}
+		if !ok {
+			// first boot, no cursor persisted, start from the most recent block.
+			num, err = remote.ETHRPCServiceInstance().ETHBlockDecimalNumber(ctx)
+			if err != nil {
+				log.Panicln(ctx, "[ETHServiceInstance]: Panic, Error ETHBlockDecimalNumber, err: ", err)
 			}
-		}()
+		}
+		eTHServiceInstance.recentBlockNumer = num
+		if err := eTHServiceInstance.resumeBackfills(ctx); err != nil {
+			log.Panicln(ctx, "[ETHServiceInstance]: Panic, Error resumeBackfills, err: ", err)
+		}
+		eTHServiceInstance.setHead(num)
+		eTHServiceInstance.refreshFinalized(ctx)
+		log.Println(ctx, "[ETHServiceInstance]: resume from block number:", num, "subscriptions:", len(subs))
+
+		// ingest new blocks, driven by newHeads or by polling eth_blockNumber.
+		go eTHServiceInstance.run(ctx, util.EnvString("ETH_TRANSPORT", TRANSPORT_POLL))
 	})
 
 	return eTHServiceInstance
@@ -70,28 +133,108 @@ func (s *ETHService) GetCurrentBlock(ctx context.Context) (*model.ETHBlockInfo,
 	return blockInfo, nil
 }
 
+// Close close the storage, a block being applied or backfilled is written in full first.
+func (s *ETHService) Close(ctx context.Context) error {
+	s.ingestMutex.Lock()
+	defer s.ingestMutex.Unlock()
+	if err := s.store.Close(); err != nil {
+		log.Println(ctx, "[Close]: Error store Close, err: ", err)
+		return err
+	}
+	return nil
+}
+
 // Subscribe subscribe an address's inbound/outbound transaction.
 func (s *ETHService) Subscribe(ctx context.Context, address string) error {
-	address = strings.ToLower(address)
+	_, err := s.SubscribeFrom(ctx, &model.ETHSubscribeRequest{Address: address, FromBlock: -1})
+	return err
+}
+
+// SubscribeFrom subscribe an address's inbound/outbound transaction,
+// if req.FromBlock is not negative, a backfill job scans history from it up to where live ingestion starts.
+// subscribing an address again only replaces its label and owner.
+func (s *ETHService) SubscribeFrom(ctx context.Context, req *model.ETHSubscribeRequest) (*model.ETHBackfillJob, error) {
+	address, err := util.ParseAddress(req.Address)
+	if err != nil {
+		return nil, err
+	}
+	fromBlock := req.FromBlock
+	startBlock, err := s.subscribe(ctx, address, req)
+	if err != nil {
+		return nil, err
+	}
+	if fromBlock < 0 {
+		return nil, nil
+	}
+	job, err := s.startBackfill(ctx, address, fromBlock, startBlock)
+	if err != nil {
+		log.Println(ctx, "[SubscribeFrom]: Error startBackfill, err: ", err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// subscribe store the subscription of address and start matching it, return the first block live ingestion matches it in.
+// the ingest loop is held from reading the cursor to registering address, so every block is either backfilled or ingested with it.
+func (s *ETHService) subscribe(ctx context.Context, address string, req *model.ETHSubscribeRequest) (int64, error) {
+	s.ingestMutex.Lock()
+	defer s.ingestMutex.Unlock()
+	startBlock := atomic.LoadInt64(&s.recentBlockNumer) + 1
+	if req.FromBlock > startBlock {
+		return 0, fmt.Errorf("from_block %d is ahead of the ingested block %d", req.FromBlock, startBlock)
+	}
+	sub, err := s.newSubscription(ctx, address, startBlock, req)
+	if err != nil {
+		log.Println(ctx, "[subscribe]: Error newSubscription, err: ", err)
+		return 0, err
+	}
+	if err := s.store.PutSubscription(ctx, sub); err != nil {
+		log.Println(ctx, "[subscribe]: Error PutSubscription, err: ", err)
+		return 0, err
+	}
 	s.addrRWMutex.Lock()
 	s.subAddrs[address] = true
 	s.addrRWMutex.Unlock()
-	return nil
+	return startBlock, nil
 }
 
-// GetTransactions get address's inbound/outbound transactions
-func (s *ETHService) GetTransactions(ctx context.Context, address string) ([]*model.ETHTransaction, error) {
+// GetTransactions get address's inbound/outbound transactions with their confirmation status.
+func (s *ETHService) GetTransactions(ctx context.Context, address string) ([]*model.ETHTransactionWithStatus, error) {
 	address = strings.ToLower(address)
-	s.txRWMutex.RLock()
-	transactions, ok := s.transactions[address]
-	if !ok {
-		transactions = make([]*model.ETHTransaction, 0)
+	transactions, err := s.store.GetTransactions(ctx, address)
+	if err != nil {
+		log.Println(ctx, "[GetTransactions]: Error store GetTransactions, err: ", err)
+		return nil, err
+	}
+	return s.withStatus(ctx, transactions), nil
+}
+
+// QueryTransactions get a page of address's transactions matching query with their confirmation status.
+func (s *ETHService) QueryTransactions(ctx context.Context, address string, query *model.ETHTxQuery) (*model.ETHTxPage, error) {
+	if err := query.Check(); err != nil {
+		return nil, err
 	}
-	s.txRWMutex.RUnlock()
-	return transactions, nil
+	address = strings.ToLower(address)
+	transactions, next, err := s.store.QueryTransactions(ctx, address, query)
+	if err != nil {
+		log.Println(ctx, "[QueryTransactions]: Error store QueryTransactions, err: ", err)
+		return nil, err
+	}
+	return &model.ETHTxPage{
+		Transactions: s.withStatus(ctx, transactions),
+		NextCursor:   next,
+	}, nil
+}
+
+// GetReorgs get recent chain reorganization events, newest first.
+func (s *ETHService) GetReorgs(ctx context.Context) ([]*model.ETHReorgEvent, error) {
+	return s.reorgs.List(), nil
 }
 
 // load load transactions via address.
+// it walks every block from the last parsed one up to the head in order, so no block is skipped.
+// when a block does not build on the last applied one, the orphaned blocks are rolled back
+// one by one and the canonical branch is re-ingested from the common ancestor.
 func (s *ETHService) load(ctx context.Context) error {
 	// 1. query new block number.
 	num, err := remote.ETHRPCServiceInstance().ETHBlockDecimalNumber(ctx)
@@ -99,56 +242,190 @@ func (s *ETHService) load(ctx context.Context) error {
 		log.Println(ctx, "[load]: Error EthBlockNumber request:", err)
 		return err
 	}
-	// 2. compare, if no new block, return
-	if s.recentBlockNumer >= num {
-		// no new block, return.
-		return nil
+	return s.loadTo(ctx, num)
+}
+
+// loadTo ingest every block up to the head num.
+func (s *ETHService) loadTo(ctx context.Context, num int64) error {
+	s.setHead(num)
+	if num > s.recentBlockNumer {
+		// finality only moves with new blocks.
+		s.refreshFinalized(ctx)
+	}
+	// 2. fetch every missing block concurrently and apply them in order, nothing to do if no new block.
+	for s.recentBlockNumer < num {
+		err := s.fetcher.Fetch(ctx, s.recentBlockNumer+1, num, func(number int64, blockInfo *model.ETHBlockInfo) error {
+			return s.ingestBlock(ctx, number, blockInfo)
+		})
+		if errors.Is(err, errRolledBack) {
+			// fetch again from the rolled back cursor.
+			continue
+		}
+		if err != nil {
+			log.Println(ctx, "[load]: Error fetch blocks:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// ingestBlock apply the next block of the chain, s.reorg collect the rollback in progress,
+// it is recorded once the first canonical block is applied, even if a later tick applies it.
+// the whole step holds ingestMutex, so a backfill sees the window and cursor consistent with the stored history.
+func (s *ETHService) ingestBlock(ctx context.Context, number int64, blockInfo *model.ETHBlockInfo) error {
+	s.ingestMutex.Lock()
+	defer s.ingestMutex.Unlock()
+	// 3. parent hash mismatch, roll back the last block and retry from its height.
+	if s.window.isReorg(number, blockInfo) {
+		if s.reorg == nil {
+			s.reorg = newReorgEvent(number)
+		}
+		orphan, err := s.rollback(ctx, s.reorg)
+		if err != nil {
+			return err
+		}
+		if orphan != nil {
+			s.reorg.BlockNumber = orphan.number
+			if err := s.saveCursor(ctx, orphan.number-1); err != nil {
+				return err
+			}
+			return errRolledBack
+		}
 	}
-	// 3. update block number.
-	s.recentBlockNumer = num
-	log.Println(ctx, "[ETHService]: Block Number:", num)
-	// 4. parse block transactions.
-	err = s.ParseTransactions(ctx, num)
+	if s.reorg != nil && s.window.isBeyond(number, blockInfo) {
+		// every block of the window was orphaned, the older ones keep their history.
+		s.reorg.Unrecoverable = true
+		log.Println(ctx, "[ingestBlock]: reorg deeper than window, accept block:", number)
+	}
+	log.Println(ctx, "[ETHService]: Block Number:", number)
+	addrs, err := s.writeBlock(ctx, blockInfo)
 	if err != nil {
-		log.Println(ctx, "[load]: Error ParseTransactions request:", err)
+		log.Println(ctx, "[ingestBlock]: Error writeBlock:", err)
+		return err
+	}
+	s.window.Push(&windowBlock{
+		number:     number,
+		hash:       string(blockInfo.Hash),
+		parentHash: string(blockInfo.ParentHash),
+		addrs:      addrs,
+	})
+	s.publishConfirmed(ctx, number)
+	if s.reorg != nil {
+		s.reorg.CommonAncestor = s.reorg.BlockNumber - 1
+		if s.reorg.Unrecoverable {
+			s.reorg.CommonAncestor = -1
+		}
+		s.reorgs.Add(ctx, s.reorg)
+		s.reorg = nil
+	}
+	// 4. advance and persist cursor only after the block is parsed, a failed block is retried next tick.
+	return s.saveCursor(ctx, number)
+}
+
+// saveCursor set and persist the last parsed block number.
+func (s *ETHService) saveCursor(ctx context.Context, number int64) error {
+	atomic.StoreInt64(&s.recentBlockNumer, number)
+	if err := s.store.SaveCursor(ctx, number); err != nil {
+		log.Println(ctx, "[saveCursor]: Error SaveCursor:", err)
 		return err
 	}
 	return nil
 }
 
-// ParseTransactions parse block transactions.
+// ParseTransactions parse block transactions, token and internal transfers and withdrawals.
 func (s *ETHService) ParseTransactions(ctx context.Context, number int64) error {
-	hexStr := fmt.Sprintf("0x%x", number)
-	blockInfo, err := remote.ETHRPCServiceInstance().EthGetBlockByNumber(ctx, hexStr)
+	blocks, err := s.fetchBlocks(ctx, []int64{number})
 	if err != nil {
-		log.Println(ctx, "[ParseTransactions]: Error EthGetBlockByNumber request:", err)
+		log.Println(ctx, "[ParseTransactions]: Error fetchBlocks request:", err)
+		return err
+	}
+	if _, err := s.applyBlock(ctx, blocks[0]); err != nil {
+		log.Println(ctx, "[ParseTransactions]: Error applyBlock:", err)
 		return err
 	}
-	transactions := blockInfo.Transactions
-	for _, tx := range transactions {
+	return nil
+}
+
+// applyBlock store block transactions, token and internal transfers and withdrawals of subscribed addresses,
+// return addresses whose history changed.
+func (s *ETHService) applyBlock(ctx context.Context, blockInfo *model.ETHBlockInfo) ([]string, error) {
+	s.ingestMutex.Lock()
+	defer s.ingestMutex.Unlock()
+	return s.writeBlock(ctx, blockInfo)
+}
+
+// writeBlock applyBlock with ingestMutex already held by the caller.
+func (s *ETHService) writeBlock(ctx context.Context, blockInfo *model.ETHBlockInfo) ([]string, error) {
+	if s.autoSubscribeContracts {
+		if err := s.subscribeDeployedContracts(ctx, blockInfo); err != nil {
+			log.Println(ctx, "[writeBlock]: Error subscribeDeployedContracts, err: ", err)
+			return nil, err
+		}
+	}
+	batch := map[string][]*model.ETHTransaction{}
+	s.addrRWMutex.RLock()
+	for _, tx := range blockInfo.Transactions {
+		from, to, created := string(tx.From), string(tx.To), string(tx.ContractCreated)
 		// if a key exists in map, store it.
-		s.addrRWMutex.RLock()
-		s.txRWMutex.Lock()
-		if _, ok := s.subAddrs[tx.From]; ok {
+		if _, ok := s.subAddrs[from]; ok {
 			// outboundTx: From -> To
-			if txList, okk := s.transactions[tx.From]; okk {
-				txList = append(txList, tx)
-				s.transactions[tx.From] = txList
-			} else {
-				s.transactions[tx.From] = []*model.ETHTransaction{tx}
-			}
+			batch[from] = append(batch[from], tx)
 		}
-		if _, ok := s.subAddrs[tx.To]; ok {
+		if _, ok := s.subAddrs[to]; ok && to != from {
 			// inboundTx: From -> To
-			if txList, okk := s.transactions[tx.To]; okk {
-				txList = append(txList, tx)
-				s.transactions[tx.To] = txList
-			} else {
-				s.transactions[tx.To] = []*model.ETHTransaction{tx}
-			}
+			batch[to] = append(batch[to], tx)
+		}
+		if _, ok := s.subAddrs[created]; ok && len(created) > 0 {
+			// a contract's history starts with its creation.
+			batch[created] = append(batch[created], tx)
 		}
-		s.addrRWMutex.RUnlock()
-		s.txRWMutex.Unlock()
 	}
-	return nil
-}
\ No newline at end of file
+	subscribed := func(addr string) bool {
+		return s.subAddrs[addr]
+	}
+	transfers := tokenTransferBatch(blockInfo, subscribed)
+	internals := internalTransferBatch(blockInfo, subscribed)
+	withdrawals := withdrawalBatch(blockInfo, subscribed)
+	s.addrRWMutex.RUnlock()
+	if len(batch) > 0 {
+		txs := flattenTransactions(batch)
+		if err := attachReceipts(ctx, s.receipts, txs); err != nil {
+			log.Println(ctx, "[writeBlock]: Error attachReceipts, err: ", err)
+			return nil, err
+		}
+		markContractCreations(txs)
+	}
+	// one batch, a failed block leaves no rows behind for a block at its height fetched again after a reorg.
+	records := &storage.BlockBatch{
+		Transactions:      batch,
+		TokenTransfers:    transfers,
+		InternalTransfers: internals,
+		Withdrawals:       withdrawals,
+	}
+	if !records.Empty() {
+		if err := s.store.AppendBlock(ctx, records); err != nil {
+			log.Println(ctx, "[writeBlock]: Error AppendBlock, err: ", err)
+			return nil, err
+		}
+	}
+	s.streams.publish(flattenTransactions(batch))
+	s.publishBlock(ctx, batch, transfers)
+	changed := map[string]bool{}
+	for addr := range batch {
+		changed[addr] = true
+	}
+	for addr := range transfers {
+		changed[addr] = true
+	}
+	for addr := range internals {
+		changed[addr] = true
+	}
+	for addr := range withdrawals {
+		changed[addr] = true
+	}
+	addrs := make([]string, 0, len(changed))
+	for addr := range changed {
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
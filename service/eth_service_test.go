@@ -52,7 +52,7 @@ func TestETHService_GetTransactions(t *testing.T) {
 		assert.Equal(t, len(list), txCase.txNum)
 		for _, tx := range list {
 			assert.Condition(t, func() (success bool) {
-				return (strings.EqualFold(tx.From, txCase.Addr)) || (strings.EqualFold(tx.To, txCase.Addr))
+				return (strings.EqualFold(string(tx.From), txCase.Addr)) || (strings.EqualFold(string(tx.To), txCase.Addr))
 			})
 		}
 	}
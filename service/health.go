@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/remote"
+)
+
+// Health report upstream endpoint health and ingest progress,
+// degraded while some endpoint is unhealthy, down when none is.
+func (s *ETHService) Health(ctx context.Context) (*model.Health, error) {
+	head := atomic.LoadInt64(&s.headBlockNumber)
+	parsed := atomic.LoadInt64(&s.recentBlockNumer)
+	lag := head - parsed
+	if lag < 0 {
+		lag = 0
+	}
+	health := &model.Health{
+		Status: model.HEALTH_STATUS_OK,
+		RPC:    remote.ETHRPCServiceInstance().Health(),
+		Ingest: &model.IngestHealth{
+			HeadBlock:      head,
+			ParsedBlock:    parsed,
+			FinalizedBlock: atomic.LoadInt64(&s.finalizedBlockNumber),
+			Lag:            lag,
+			Transport:      s.currentTransport(),
+		},
+	}
+	switch {
+	case health.RPC.Healthy == 0:
+		health.Status = model.HEALTH_STATUS_DOWN
+	case health.RPC.Healthy < len(health.RPC.Endpoints):
+		health.Status = model.HEALTH_STATUS_DEGRADED
+	}
+	return health, nil
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/remote"
+)
+
+// fetchBlocks fetch blocks with their token logs and, if tracing is on, their internal transfers.
+func (s *ETHService) fetchBlocks(ctx context.Context, numbers []int64) ([]*model.ETHBlockInfo, error) {
+	blocks, err := fetchBlocksByNumber(ctx, numbers)
+	if err != nil || s.traceMode == model.TRACE_MODE_OFF {
+		return blocks, err
+	}
+	if err := attachInternalTransfers(ctx, s.traceMode, blocks); err != nil {
+		log.Println(ctx, "[fetchBlocks]: Error attachInternalTransfers, err: ", err)
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// attachInternalTransfers trace blocks and attach their value-bearing internal calls.
+func attachInternalTransfers(ctx context.Context, traceMode string, blocks []*model.ETHBlockInfo) error {
+	switch traceMode {
+	case model.TRACE_MODE_DEBUG:
+		hashes := make([]string, len(blocks))
+		for i, blockInfo := range blocks {
+			hashes[i] = string(blockInfo.Hash)
+		}
+		traces, err := remote.ETHRPCServiceInstance().DebugTraceBlocksByHash(ctx, hashes)
+		if err != nil {
+			return err
+		}
+		for i, blockInfo := range blocks {
+			if blockInfo.InternalTransfers, err = callTraceTransfers(blockInfo, traces[i]); err != nil {
+				return err
+			}
+		}
+	case model.TRACE_MODE_PARITY:
+		numbers := make([]int64, len(blocks))
+		for i, blockInfo := range blocks {
+			numbers[i] = int64(blockInfo.Number)
+		}
+		traces, err := remote.ETHRPCServiceInstance().TraceBlocks(ctx, numbers)
+		if err != nil {
+			return err
+		}
+		for i, blockInfo := range blocks {
+			if blockInfo.InternalTransfers, err = parityTraceTransfers(blockInfo, traces[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown trace mode %q", traceMode)
+	}
+	return nil
+}
+
+// callTraceTransfers extract internal transfers from the callTracer result of every transaction of blockInfo.
+func callTraceTransfers(blockInfo *model.ETHBlockInfo, traces []*model.ETHTxCallTrace) ([]*model.ETHInternalTransfer, error) {
+	if len(traces) != len(blockInfo.Transactions) {
+		return nil, errors.New("traces do not match block transactions")
+	}
+	transfers := make([]*model.ETHInternalTransfer, 0)
+	for i, trace := range traces {
+		tx := blockInfo.Transactions[i]
+		if len(trace.TxHash) > 0 && model.Hash(strings.ToLower(trace.TxHash)) != tx.Hash {
+			return nil, errors.New("traces do not match block transactions")
+		}
+		if trace.Result == nil || len(trace.Result.Error) > 0 {
+			// a failed transaction reverts every nested call.
+			continue
+		}
+		for j, call := range trace.Result.Calls {
+			transfers = walkCallFrame(transfers, blockInfo, tx, call, []int{j})
+		}
+	}
+	return transfers, nil
+}
+
+// walkCallFrame append frame and its nested calls carrying value, a reverted frame is skipped with its subtree.
+func walkCallFrame(transfers []*model.ETHInternalTransfer, blockInfo *model.ETHBlockInfo, tx *model.ETHTransaction,
+	frame *model.ETHCallFrame, traceAddress []int) []*model.ETHInternalTransfer {
+	if len(frame.Error) > 0 {
+		return transfers
+	}
+	callType := strings.ToLower(frame.Type)
+	switch callType {
+	case "call", "create", "create2", "selfdestruct":
+		// DELEGATECALL and CALLCODE report the value of their parent, STATICCALL cannot move value.
+		if hasValue(frame.Value) {
+			transfers = append(transfers, newInternalTransfer(blockInfo, tx, frame.From, frame.To, frame.Value, callType, traceAddress))
+		}
+	}
+	for i, call := range frame.Calls {
+		transfers = walkCallFrame(transfers, blockInfo, tx, call, append(append([]int{}, traceAddress...), i))
+	}
+	return transfers
+}
+
+// parityTraceTransfers extract internal transfers from the trace_block result of blockInfo.
+func parityTraceTransfers(blockInfo *model.ETHBlockInfo, traces []*model.ETHParityTrace) ([]*model.ETHInternalTransfer, error) {
+	transfers := make([]*model.ETHInternalTransfer, 0)
+	// reverted calls per transaction, their nested calls are reverted too.
+	reverted := map[string][][]int{}
+	for _, trace := range traces {
+		if trace.Type == "reward" || len(trace.TransactionHash) == 0 {
+			continue
+		}
+		if model.Hash(strings.ToLower(trace.BlockHash)) != blockInfo.Hash {
+			return nil, errors.New("traces do not match fetched block")
+		}
+		if trace.TransactionPosition < 0 || trace.TransactionPosition >= len(blockInfo.Transactions) {
+			return nil, errors.New("traces do not match block transactions")
+		}
+		if len(trace.Error) > 0 {
+			reverted[trace.TransactionHash] = append(reverted[trace.TransactionHash], trace.TraceAddress)
+			continue
+		}
+		if len(trace.TraceAddress) == 0 || trace.Action == nil || isReverted(reverted[trace.TransactionHash], trace.TraceAddress) {
+			// the top level call is the transaction itself.
+			continue
+		}
+		tx := blockInfo.Transactions[trace.TransactionPosition]
+		action := trace.Action
+		switch {
+		case trace.Type == "call" && action.CallType == "call" && hasValue(action.Value):
+			transfers = append(transfers, newInternalTransfer(blockInfo, tx, action.From, action.To, action.Value, "call", trace.TraceAddress))
+		case trace.Type == "create" && hasValue(action.Value) && trace.Result != nil:
+			transfers = append(transfers, newInternalTransfer(blockInfo, tx, action.From, trace.Result.Address, action.Value, "create", trace.TraceAddress))
+		case trace.Type == "suicide" && hasValue(action.Balance):
+			transfers = append(transfers, newInternalTransfer(blockInfo, tx, action.Address, action.RefundAddress, action.Balance, "selfdestruct", trace.TraceAddress))
+		}
+	}
+	return transfers, nil
+}
+
+// isReverted report whether traceAddress is nested in one of the reverted calls.
+func isReverted(reverted [][]int, traceAddress []int) bool {
+	for _, prefix := range reverted {
+		if len(prefix) > len(traceAddress) {
+			continue
+		}
+		nested := true
+		for i := range prefix {
+			if prefix[i] != traceAddress[i] {
+				nested = false
+				break
+			}
+		}
+		if nested {
+			return true
+		}
+	}
+	return false
+}
+
+// newInternalTransfer internal transfer of a call in tx.
+func newInternalTransfer(blockInfo *model.ETHBlockInfo, tx *model.ETHTransaction, from, to, value, callType string, traceAddress []int) *model.ETHInternalTransfer {
+	return &model.ETHInternalTransfer{
+		TransactionHash:  tx.Hash,
+		TransactionIndex: tx.TransactionIndex,
+		BlockNumber:      blockInfo.Number,
+		BlockHash:        blockInfo.Hash,
+		From:             model.Address(strings.ToLower(from)),
+		To:               model.Address(strings.ToLower(to)),
+		Value:            model.NewWei(hexQuantity(value)),
+		CallType:         callType,
+		TraceAddress:     traceAddress,
+	}
+}
+
+// hasValue report whether a hex quantity is not zero.
+func hasValue(value string) bool {
+	return hexQuantity(value).Sign() > 0
+}
+
+// hexQuantity parse a hex quantity, 0 if empty or malformed.
+func hexQuantity(value string) *big.Int {
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(value, "0x"), 16)
+	if !ok {
+		return new(big.Int)
+	}
+	return n
+}
+
+// internalTransferBatch group internal transfers of blockInfo by subscribed sender and recipient.
+func internalTransferBatch(blockInfo *model.ETHBlockInfo, subscribed func(addr string) bool) map[string][]*model.ETHInternalTransfer {
+	batch := map[string][]*model.ETHInternalTransfer{}
+	for _, transfer := range blockInfo.InternalTransfers {
+		from, to := string(transfer.From), string(transfer.To)
+		if subscribed(from) {
+			batch[from] = append(batch[from], transfer)
+		}
+		if subscribed(to) && to != from {
+			batch[to] = append(batch[to], transfer)
+		}
+	}
+	return batch
+}
+
+// GetInternalTransfers list internal transfers from or to address, empty unless tracing is on.
+func (s *ETHService) GetInternalTransfers(ctx context.Context, address string) ([]*model.ETHInternalTransfer, error) {
+	transfers, err := s.store.GetInternalTransfers(ctx, address)
+	if err != nil {
+		log.Println(ctx, "[GetInternalTransfers]: Error GetInternalTransfers, err: ", err)
+		return nil, err
+	}
+	return transfers, nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+const (
+	testMultisig = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	testRouter   = "0x7a250d5630b4cf539739df2c5dacb4c659f2488d"
+	testUser     = "0x52908400098527886e0f7030069857d2e4169ee7"
+)
+
+func testTraceBlock() *model.ETHBlockInfo {
+	return &model.ETHBlockInfo{
+		Hash:   "0xb",
+		Number: 0x10,
+		Transactions: []*model.ETHTransaction{
+			{Hash: "0x1", TransactionIndex: 0x0, From: testUser, To: testRouter},
+			{Hash: "0x2", TransactionIndex: 0x1, From: testUser, To: testRouter},
+		},
+	}
+}
+
+func TestCallTraceTransfers(t *testing.T) {
+	blockInfo := testTraceBlock()
+	traces := []*model.ETHTxCallTrace{
+		{TxHash: "0x1", Result: &model.ETHCallFrame{Type: "CALL", From: testUser, To: testRouter, Value: "0x5", Calls: []*model.ETHCallFrame{
+			{Type: "STATICCALL", From: testRouter, To: testUser},
+			{Type: "DELEGATECALL", From: testRouter, To: testUser, Value: "0x5"},
+			{Type: "CALL", From: testRouter, To: testMultisig, Value: "0x3", Calls: []*model.ETHCallFrame{
+				{Type: "CALL", From: testMultisig, To: testUser, Value: "0x1"},
+			}},
+			{Type: "CALL", From: testRouter, To: testMultisig, Value: "0x2", Error: "execution reverted", Calls: []*model.ETHCallFrame{
+				{Type: "CALL", From: testMultisig, To: testUser, Value: "0x2"},
+			}},
+		}}},
+		// failed transaction, nothing moved.
+		{TxHash: "0x2", Result: &model.ETHCallFrame{Type: "CALL", Error: "out of gas", Calls: []*model.ETHCallFrame{
+			{Type: "CALL", From: testRouter, To: testMultisig, Value: "0x9"},
+		}}},
+	}
+	transfers, err := callTraceTransfers(blockInfo, traces)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(transfers))
+	assert.Equal(t, model.Address(testMultisig), transfers[0].To)
+	assert.Equal(t, "0x3", transfers[0].Value.String())
+	assert.Equal(t, []int{2}, transfers[0].TraceAddress)
+	assert.Equal(t, model.Hash("0x1"), transfers[0].TransactionHash)
+	assert.Equal(t, model.Address(testMultisig), transfers[1].From)
+	assert.Equal(t, []int{2, 0}, transfers[1].TraceAddress)
+
+	batch := internalTransferBatch(&model.ETHBlockInfo{InternalTransfers: transfers}, func(addr string) bool {
+		return addr == testMultisig
+	})
+	assert.Equal(t, 2, len(batch[testMultisig]))
+
+	_, err = callTraceTransfers(blockInfo, traces[:1])
+	assert.NotNil(t, err)
+}
+
+func TestParityTraceTransfers(t *testing.T) {
+	blockInfo := testTraceBlock()
+	traces := []*model.ETHParityTrace{
+		{Type: "call", BlockHash: "0xb", TransactionHash: "0x1", TransactionPosition: 0, TraceAddress: []int{},
+			Action: &model.ETHParityTraceAction{CallType: "call", From: testUser, To: testRouter, Value: "0x5"}},
+		{Type: "call", BlockHash: "0xb", TransactionHash: "0x1", TransactionPosition: 0, TraceAddress: []int{0},
+			Action: &model.ETHParityTraceAction{CallType: "call", From: testRouter, To: testMultisig, Value: "0x3"}},
+		{Type: "call", BlockHash: "0xb", TransactionHash: "0x1", TransactionPosition: 0, TraceAddress: []int{1}, Error: "Reverted",
+			Action: &model.ETHParityTraceAction{CallType: "call", From: testRouter, To: testMultisig, Value: "0x2"}},
+		{Type: "call", BlockHash: "0xb", TransactionHash: "0x1", TransactionPosition: 0, TraceAddress: []int{1, 0},
+			Action: &model.ETHParityTraceAction{CallType: "call", From: testMultisig, To: testUser, Value: "0x2"}},
+		{Type: "suicide", BlockHash: "0xb", TransactionHash: "0x2", TransactionPosition: 1, TraceAddress: []int{0},
+			Action: &model.ETHParityTraceAction{Address: testRouter, RefundAddress: testMultisig, Balance: "0x7"}},
+		{Type: "reward", BlockHash: "0xb", Action: &model.ETHParityTraceAction{}},
+	}
+	transfers, err := parityTraceTransfers(blockInfo, traces)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(transfers))
+	assert.Equal(t, "call", transfers[0].CallType)
+	assert.Equal(t, "0x3", transfers[0].Value.String())
+	assert.Equal(t, "selfdestruct", transfers[1].CallType)
+	assert.Equal(t, model.Address(testMultisig), transfers[1].To)
+	assert.Equal(t, model.Hash("0x2"), transfers[1].TransactionHash)
+
+	traces[1].BlockHash = "0xother"
+	_, err = parityTraceTransfers(blockInfo, traces)
+	assert.NotNil(t, err)
+
+	// a negative position from a bad upstream is rejected, not indexed.
+	traces[1].BlockHash = "0xb"
+	traces[1].TransactionPosition = -1
+	_, err = parityTraceTransfers(blockInfo, traces)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/util"
+)
+
+// maxPushBlockTokens how many recent blocks remember the tokens of their pushed transfers.
+const maxPushBlockTokens = 256
+
+var (
+	// errPushConnLimit every push connection slot is taken.
+	errPushConnLimit = errors.New("too many push connections")
+	// errPushTopicLimit the connection would exceed its topic limit.
+	errPushTopicLimit = errors.New("too many topics on the connection")
+)
+
+// PushConn a push socket connection: its topics and the messages waiting to be written.
+type PushConn struct {
+	mutex  sync.RWMutex
+	topics map[string]bool
+	events chan *model.ETHPushMessage
+}
+
+// Events pushed events in ingest order, closed when the connection falls behind or is closed.
+func (c *PushConn) Events() <-chan *model.ETHPushMessage {
+	return c.events
+}
+
+// Topics subscribed topics of the connection, sorted.
+func (c *PushConn) Topics() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// match topics of the connection event matches, in event, address then token order.
+func (c *PushConn) match(event *model.ETHPushEvent) []string {
+	candidates := []string{model.PUSH_TOPIC_EVENT + ":" + event.Type}
+	for _, addr := range event.Addresses {
+		candidates = append(candidates, model.PUSH_TOPIC_ADDRESS+":"+string(addr))
+	}
+	for _, token := range event.Tokens {
+		candidates = append(candidates, model.PUSH_TOPIC_TOKEN+":"+string(token))
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	topics := make([]string, 0)
+	for _, topic := range candidates {
+		if c.topics[topic] {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// pushHub fan out ingest events to push connections by topic.
+type pushHub struct {
+	mutex       sync.Mutex
+	conns       map[*PushConn]bool
+	buffer      int // messages a connection may lag behind before it is dropped.
+	maxConns    int
+	maxTopics   int                        // topics per connection.
+	blockTokens map[string][]model.Address // tokens of the transfers pushed for a recent block hash, so its removal reaches their topics.
+	blockHashes []string                   // blockTokens keys, oldest first.
+}
+
+func newPushHub(buffer, maxConns, maxTopics int) *pushHub {
+	return &pushHub{
+		conns:       map[*PushConn]bool{},
+		buffer:      buffer,
+		maxConns:    maxConns,
+		maxTopics:   maxTopics,
+		blockTokens: map[string][]model.Address{},
+	}
+}
+
+// open open a connection without topics.
+func (h *pushHub) open() (*PushConn, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.conns) >= h.maxConns {
+		return nil, errPushConnLimit
+	}
+	conn := &PushConn{topics: map[string]bool{}, events: make(chan *model.ETHPushMessage, h.buffer)}
+	h.conns[conn] = true
+	return conn, nil
+}
+
+// close close conn if it is still open.
+func (h *pushHub) close(conn *PushConn) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.conns[conn] {
+		delete(h.conns, conn)
+		close(conn.events)
+	}
+}
+
+// active report whether a connection is open, a nil hub has none.
+func (h *pushHub) active() bool {
+	if h == nil {
+		return false
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.conns) > 0
+}
+
+// publish push events to the connections of their topics, a connection whose buffer is full is dropped
+// rather than blocking ingestion. a nil hub has no connection.
+func (h *pushHub) publish(events []*model.ETHPushEvent) {
+	if h == nil || len(events) == 0 {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, event := range events {
+		h.rememberTokens(event)
+		for conn := range h.conns {
+			topics := conn.match(event)
+			if len(topics) == 0 {
+				continue
+			}
+			select {
+			case conn.events <- &model.ETHPushMessage{Topics: topics, Event: event}:
+			default:
+				delete(h.conns, conn)
+				close(conn.events)
+			}
+		}
+	}
+}
+
+// rememberTokens record the token of a transfer event by block, fill in the tokens of a removed block.
+func (h *pushHub) rememberTokens(event *model.ETHPushEvent) {
+	hash := string(event.BlockHash)
+	switch event.Type {
+	case model.PUSH_EVENT_TOKEN_TRANSFER:
+		tokens, ok := h.blockTokens[hash]
+		if !ok {
+			h.blockHashes = append(h.blockHashes, hash)
+			if len(h.blockHashes) > maxPushBlockTokens {
+				delete(h.blockTokens, h.blockHashes[0])
+				h.blockHashes = h.blockHashes[1:]
+			}
+		}
+		for _, token := range tokens {
+			if token == event.TokenTransfer.Token {
+				return
+			}
+		}
+		h.blockTokens[hash] = append(tokens, event.TokenTransfer.Token)
+	case model.PUSH_EVENT_REMOVED:
+		event.Tokens = h.blockTokens[hash]
+	}
+}
+
+// parsePushTopic validate topic and return it normalized, addresses lowercased.
+func parsePushTopic(topic string) (string, error) {
+	kind, value, ok := strings.Cut(strings.TrimSpace(topic), ":")
+	if !ok {
+		return "", fmt.Errorf("topic %q is not kind:value", topic)
+	}
+	switch kind {
+	case model.PUSH_TOPIC_ADDRESS, model.PUSH_TOPIC_TOKEN:
+		address, err := util.ParseAddress(value)
+		if err != nil {
+			return "", fmt.Errorf("topic %q: %w", topic, err)
+		}
+		return kind + ":" + address, nil
+	case model.PUSH_TOPIC_EVENT:
+		switch value {
+		case model.PUSH_EVENT_TRANSACTION, model.PUSH_EVENT_TOKEN_TRANSFER, model.PUSH_EVENT_CONFIRMED, model.PUSH_EVENT_REMOVED:
+			return kind + ":" + value, nil
+		}
+		return "", fmt.Errorf("unknown event type %q", value)
+	default:
+		return "", fmt.Errorf("unknown topic kind %q", kind)
+	}
+}
+
+// OpenPush open a push connection without topics, at most PUSH_MAX_CONNECTIONS are open at once.
+func (s *ETHService) OpenPush(ctx context.Context) (*PushConn, error) {
+	conn, err := s.pushes.open()
+	if err != nil {
+		log.Println(ctx, "[OpenPush]: Error open, err: ", err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ClosePush close conn, its Events channel is closed.
+func (s *ETHService) ClosePush(conn *PushConn) {
+	s.pushes.close(conn)
+}
+
+// PushSubscribe add topics to conn, all or none of them, an address topic needs a subscribed address.
+func (s *ETHService) PushSubscribe(ctx context.Context, conn *PushConn, topics []string) error {
+	parsed := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		topic, err := parsePushTopic(topic)
+		if err != nil {
+			return err
+		}
+		if address := strings.TrimPrefix(topic, model.PUSH_TOPIC_ADDRESS+":"); address != topic {
+			if _, ok, err := s.store.GetSubscription(ctx, address); err != nil || !ok {
+				if err == nil {
+					err = fmt.Errorf("%s: %w", address, errNotSubscribed)
+				}
+				log.Println(ctx, "[PushSubscribe]: Error GetSubscription, err: ", err)
+				return err
+			}
+		}
+		parsed = append(parsed, topic)
+	}
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	added := map[string]bool{}
+	for _, topic := range parsed {
+		if !conn.topics[topic] {
+			added[topic] = true
+		}
+	}
+	if len(conn.topics)+len(added) > s.pushes.maxTopics {
+		return errPushTopicLimit
+	}
+	for _, topic := range parsed {
+		conn.topics[topic] = true
+	}
+	return nil
+}
+
+// PushUnsubscribe remove topics from conn, topics it does not have are ignored.
+func (s *ETHService) PushUnsubscribe(ctx context.Context, conn *PushConn, topics []string) error {
+	parsed := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		topic, err := parsePushTopic(topic)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, topic)
+	}
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	for _, topic := range parsed {
+		delete(conn.topics, topic)
+	}
+	return nil
+}
+
+// publishBlock push transaction and token transfer events of an applied block, batches are keyed by subscribed address.
+func (s *ETHService) publishBlock(ctx context.Context, batch map[string][]*model.ETHTransaction, transfers map[string][]*model.ETHTokenTransfer) {
+	if !s.pushes.active() {
+		return
+	}
+	events := make([]*model.ETHPushEvent, 0)
+	txAddrs := map[model.Hash][]model.Address{}
+	for addr, txs := range batch {
+		for _, tx := range txs {
+			txAddrs[tx.Hash] = append(txAddrs[tx.Hash], model.Address(addr))
+		}
+	}
+	txs := sortTransactions(flattenTransactions(batch))
+	for i, item := range s.withStatus(ctx, txs) {
+		events = append(events, &model.ETHPushEvent{
+			Type:        model.PUSH_EVENT_TRANSACTION,
+			Addresses:   sortedAddresses(txAddrs[txs[i].Hash]),
+			BlockNumber: txs[i].BlockNumber,
+			BlockHash:   txs[i].BlockHash,
+			Transaction: item,
+		})
+	}
+	type logKey struct {
+		logIndex   model.Uint64
+		batchIndex int
+	}
+	transferAddrs := map[logKey][]model.Address{}
+	list := make([]*model.ETHTokenTransfer, 0)
+	for addr, items := range transfers {
+		for _, transfer := range items {
+			key := logKey{transfer.LogIndex, transfer.BatchIndex}
+			if _, ok := transferAddrs[key]; !ok {
+				list = append(list, transfer)
+			}
+			transferAddrs[key] = append(transferAddrs[key], model.Address(addr))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LogIndex != list[j].LogIndex {
+			return list[i].LogIndex < list[j].LogIndex
+		}
+		return list[i].BatchIndex < list[j].BatchIndex
+	})
+	for _, transfer := range list {
+		events = append(events, &model.ETHPushEvent{
+			Type:          model.PUSH_EVENT_TOKEN_TRANSFER,
+			Addresses:     sortedAddresses(transferAddrs[logKey{transfer.LogIndex, transfer.BatchIndex}]),
+			Tokens:        []model.Address{transfer.Token},
+			BlockNumber:   transfer.BlockNumber,
+			BlockHash:     transfer.BlockHash,
+			TokenTransfer: transfer,
+		})
+	}
+	s.pushes.publish(events)
+}
+
+// reorgWindowSize size of the reorg window, grown to the confirmation depth
+// so a block is still in the window when its transactions reach the threshold and get pushed.
+func reorgWindowSize(reorgWindow, confirmationBlocks int64) int {
+	if confirmationBlocks > reorgWindow {
+		return int(confirmationBlocks)
+	}
+	return int(reorgWindow)
+}
+
+// publishConfirmed push confirmed events of the transactions which reach the confirmation threshold
+// once block number is applied, a block already out of the reorg window is skipped.
+func (s *ETHService) publishConfirmed(ctx context.Context, number int64) {
+	if !s.pushes.active() {
+		return
+	}
+	depth := s.confirmationBlocks
+	if depth < 1 {
+		depth = 1
+	}
+	block := s.window.Find(number - depth + 1)
+	if block == nil || len(block.addrs) == 0 {
+		return
+	}
+	addrs := make(map[string]bool, len(block.addrs))
+	txs := make([]*model.ETHTransaction, 0)
+	for _, addr := range block.addrs {
+		addrs[addr] = true
+		query := &model.ETHTxQuery{
+			Limit:     model.MAX_PAGE_LIMIT,
+			Order:     model.ORDER_ASC,
+			FromBlock: uint64(block.number),
+			ToBlock:   uint64(block.number),
+		}
+		list, _, err := s.store.QueryTransactions(ctx, addr, query)
+		if err != nil {
+			log.Println(ctx, "[publishConfirmed]: Error store QueryTransactions, err: ", err)
+			return
+		}
+		for _, tx := range list {
+			if string(tx.BlockHash) == block.hash {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	txs = sortTransactions(txs)
+	events := make([]*model.ETHPushEvent, 0, len(txs))
+	for i, item := range s.withStatus(ctx, txs) {
+		events = append(events, &model.ETHPushEvent{
+			Type:        model.PUSH_EVENT_CONFIRMED,
+			Addresses:   matchAddresses(addrs, txs[i]),
+			BlockNumber: txs[i].BlockNumber,
+			BlockHash:   txs[i].BlockHash,
+			Transaction: item,
+		})
+	}
+	s.pushes.publish(events)
+}
+
+// publishRemoved push the removed event of a block rolled back from the histories of its addresses.
+func (s *ETHService) publishRemoved(orphan *windowBlock, removed []string) {
+	if !s.pushes.active() {
+		return
+	}
+	addrs := make([]model.Address, 0, len(orphan.addrs))
+	for _, addr := range orphan.addrs {
+		addrs = append(addrs, model.Address(addr))
+	}
+	s.pushes.publish([]*model.ETHPushEvent{{
+		Type:                model.PUSH_EVENT_REMOVED,
+		Addresses:           sortedAddresses(addrs),
+		BlockNumber:         model.Uint64(orphan.number),
+		BlockHash:           model.Hash(orphan.hash),
+		RemovedTransactions: removed,
+	}})
+}
+
+// sortedAddresses sort addrs in place and return them.
+func sortedAddresses(addrs []model.Address) []model.Address {
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i] < addrs[j]
+	})
+	return addrs
+}
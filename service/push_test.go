@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/storage"
+	"github.com/tj/assert"
+)
+
+// nextPush the next pushed message of conn, nil if none is waiting.
+func nextPush(conn *PushConn) *model.ETHPushMessage {
+	select {
+	case msg := <-conn.Events():
+		return msg
+	default:
+		return nil
+	}
+}
+
+func TestETHService_Push(t *testing.T) {
+	ctx := context.Background()
+	const (
+		addr  = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+		other = "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	)
+	s := &ETHService{
+		subAddrs:           map[string]bool{},
+		store:              storage.NewMemoryStorage(""),
+		window:             newBlockWindow(8),
+		reorgs:             &reorgLog{},
+		confirmationBlocks: 2,
+		pushes:             newPushHub(16, 2, 3),
+	}
+	assert.Nil(t, s.Subscribe(ctx, addr))
+
+	wallet, err := s.OpenPush(ctx)
+	assert.Nil(t, err)
+	token, err := s.OpenPush(ctx)
+	assert.Nil(t, err)
+	_, err = s.OpenPush(ctx)
+	assert.Equal(t, errPushConnLimit, err)
+
+	assert.Nil(t, s.PushSubscribe(ctx, wallet, []string{"address:0xae2Fc483527B8EF99EB5D9B44875F005ba1FaE13"}))
+	assert.Equal(t, []string{"address:" + addr}, wallet.Topics())
+	assert.Nil(t, s.PushSubscribe(ctx, token, []string{"token:" + testUSDT, "event:confirmed", "event:confirmed"}))
+	err = s.PushSubscribe(ctx, token, []string{"address:" + other})
+	assert.True(t, errors.Is(err, errNotSubscribed))
+	for _, topic := range []string{"", "address", "block:1", "event:mined", "token:0x1"} {
+		assert.NotNil(t, s.PushSubscribe(ctx, token, []string{topic}), topic)
+	}
+	// all or none of the topics are added.
+	assert.Equal(t, errPushTopicLimit, s.PushSubscribe(ctx, token, []string{"event:removed", "event:transaction"}))
+	assert.Equal(t, []string{"event:confirmed", "token:" + testUSDT}, token.Topics())
+
+	blocks := []*model.ETHBlockInfo{
+		{Number: 0xa, Hash: "0xa", Transactions: []*model.ETHTransaction{
+			{Hash: "0x1", BlockHash: "0xa", BlockNumber: 0xa, From: addr, To: other},
+		}},
+		{Number: 0xb, Hash: "0xb", ParentHash: "0xa", Transactions: []*model.ETHTransaction{
+			{Hash: "0x2", BlockHash: "0xb", BlockNumber: 0xb, From: other, To: testUSDT},
+		}, Logs: []*model.ETHLog{{
+			Address:         testUSDT,
+			Topics:          []string{model.TOPIC_TRANSFER, testSender, testRecipient},
+			Data:            "0x0000000000000000000000000000000000000000000000000000000000000001",
+			BlockHash:       "0xb",
+			BlockNumber:     0xb,
+			TransactionHash: "0x2",
+		}}},
+	}
+	s.receipts = stubReceipts(blocks...)
+	for _, blockInfo := range blocks {
+		assert.Nil(t, s.ingestBlock(ctx, int64(blockInfo.Number), blockInfo))
+	}
+
+	// the wallet gets its transaction, the incoming transfer and the confirmation of block 0xa.
+	msg := nextPush(wallet)
+	assert.Equal(t, model.PUSH_EVENT_TRANSACTION, msg.Event.Type)
+	assert.Equal(t, model.Hash("0x1"), msg.Event.Transaction.Hash)
+	assert.Equal(t, []string{"address:" + addr}, msg.Topics)
+	msg = nextPush(wallet)
+	assert.Equal(t, model.PUSH_EVENT_TOKEN_TRANSFER, msg.Event.Type)
+	assert.Equal(t, model.Address(addr), msg.Event.TokenTransfer.To)
+	msg = nextPush(wallet)
+	assert.Equal(t, model.PUSH_EVENT_CONFIRMED, msg.Event.Type)
+	assert.Equal(t, model.Hash("0x1"), msg.Event.Transaction.Hash)
+	assert.Equal(t, model.TX_STATUS_PENDING_CONFIRMATION, msg.Event.Transaction.Status)
+	assert.Nil(t, nextPush(wallet))
+
+	// the token watcher gets the transfer and every confirmation.
+	msg = nextPush(token)
+	assert.Equal(t, model.PUSH_EVENT_TOKEN_TRANSFER, msg.Event.Type)
+	assert.Equal(t, []string{"token:" + testUSDT}, msg.Topics)
+	msg = nextPush(token)
+	assert.Equal(t, []string{"event:confirmed"}, msg.Topics)
+	assert.Equal(t, []model.Address{addr}, msg.Event.Addresses)
+	assert.Nil(t, nextPush(token))
+
+	// block 0xb is orphaned, its removal reaches the wallet and the token watcher.
+	err = s.ingestBlock(ctx, 0xc, &model.ETHBlockInfo{Number: 0xc, Hash: "0xc", ParentHash: "0xbb"})
+	assert.Equal(t, errRolledBack, err)
+	for _, conn := range []*PushConn{wallet, token} {
+		msg = nextPush(conn)
+		assert.Equal(t, model.PUSH_EVENT_REMOVED, msg.Event.Type)
+		assert.Equal(t, model.Hash("0xb"), msg.Event.BlockHash)
+		assert.Equal(t, []model.Address{testUSDT}, msg.Event.Tokens)
+		assert.Equal(t, []string{"0x2"}, msg.Event.RemovedTransactions)
+		assert.Nil(t, nextPush(conn))
+	}
+
+	assert.Nil(t, s.PushUnsubscribe(ctx, token, []string{"token:" + testUSDT, "event:removed"}))
+	assert.Equal(t, []string{"event:confirmed"}, token.Topics())
+	s.ClosePush(wallet)
+	_, ok := <-wallet.Events()
+	assert.False(t, ok)
+	_, err = s.OpenPush(ctx)
+	assert.Nil(t, err)
+}
+
+func TestPushHub_DropLagging(t *testing.T) {
+	hub := newPushHub(1, 1, 1)
+	conn, err := hub.open()
+	assert.Nil(t, err)
+	conn.topics["event:removed"] = true
+	hub.publish([]*model.ETHPushEvent{{Type: model.PUSH_EVENT_CONFIRMED}})
+	assert.Equal(t, 0, len(conn.events))
+	hub.publish([]*model.ETHPushEvent{{Type: model.PUSH_EVENT_REMOVED}, {Type: model.PUSH_EVENT_REMOVED}})
+	_, ok := <-conn.Events()
+	assert.True(t, ok)
+	_, ok = <-conn.Events()
+	assert.False(t, ok)
+	// the dropped connection frees its slot, closing it again is a no-op.
+	hub.close(conn)
+	_, err = hub.open()
+	assert.Nil(t, err)
+}
+
+func TestETHService_PushConfirmedBeyondWindow(t *testing.T) {
+	ctx := context.Background()
+	const addr = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	assert.Equal(t, 64, reorgWindowSize(64, 12))
+	assert.Equal(t, 12, reorgWindowSize(4, 12))
+	// REORG_WINDOW 1 with CONFIRMATION_BLOCKS 3.
+	s := &ETHService{
+		subAddrs:           map[string]bool{addr: true},
+		store:              storage.NewMemoryStorage(""),
+		window:             newBlockWindow(reorgWindowSize(1, 3)),
+		reorgs:             &reorgLog{},
+		confirmationBlocks: 3,
+		pushes:             newPushHub(16, 1, 1),
+	}
+	conn, err := s.OpenPush(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, s.PushSubscribe(ctx, conn, []string{"event:confirmed"}))
+	blocks := []*model.ETHBlockInfo{
+		{Number: 0xa, Hash: "0xa", Transactions: []*model.ETHTransaction{{Hash: "0x1", BlockHash: "0xa", BlockNumber: 0xa, From: addr}}},
+		{Number: 0xb, Hash: "0xb", ParentHash: "0xa"},
+		{Number: 0xc, Hash: "0xc", ParentHash: "0xb"},
+	}
+	s.receipts = stubReceipts(blocks...)
+	for _, blockInfo := range blocks {
+		assert.Nil(t, s.ingestBlock(ctx, int64(blockInfo.Number), blockInfo))
+	}
+	msg := nextPush(conn)
+	assert.NotNil(t, msg)
+	assert.Equal(t, model.PUSH_EVENT_CONFIRMED, msg.Event.Type)
+	assert.Equal(t, model.Hash("0x1"), msg.Event.Transaction.Hash)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/remote"
+)
+
+// receiptBatchSize receipts fetched per batch request.
+const receiptBatchSize = 50
+
+// fetchReceiptsFunc fetch receipts of transaction hashes, returned in the same order.
+type fetchReceiptsFunc func(ctx context.Context, hashes []string) ([]*model.ETHTransactionReceipt, error)
+
+// fetchReceipts default fetchReceiptsFunc calling eth_getTransactionReceipt in one batch.
+func fetchReceipts(ctx context.Context, hashes []string) ([]*model.ETHTransactionReceipt, error) {
+	return remote.ETHRPCServiceInstance().EthGetTransactionReceipts(ctx, hashes)
+}
+
+// attachReceipts fetch the receipts of txs missing one and attach their outcome and cost.
+func attachReceipts(ctx context.Context, fetch fetchReceiptsFunc, txs []*model.ETHTransaction) error {
+	pending := make([]*model.ETHTransaction, 0, len(txs))
+	seen := map[model.Hash]bool{}
+	for _, tx := range txs {
+		if tx.Receipt == nil && !seen[tx.Hash] {
+			seen[tx.Hash] = true
+			pending = append(pending, tx)
+		}
+	}
+	for start := 0; start < len(pending); start += receiptBatchSize {
+		end := start + receiptBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		hashes := make([]string, 0, end-start)
+		for _, tx := range pending[start:end] {
+			hashes = append(hashes, string(tx.Hash))
+		}
+		receipts, err := fetch(ctx, hashes)
+		if err != nil {
+			log.Println(ctx, "[attachReceipts]: Error fetch receipts, err: ", err)
+			return err
+		}
+		if len(receipts) != len(hashes) {
+			return errors.New("fetched receipts count mismatch")
+		}
+		for i, tx := range pending[start:end] {
+			if receipts[i].BlockHash != tx.BlockHash {
+				// the transaction was included in another block since the block was fetched.
+				return errors.New("receipt does not match transaction block")
+			}
+			tx.Receipt = receiptInfo(receipts[i], tx)
+		}
+	}
+	return nil
+}
+
+// flattenTransactions transactions of a per-address batch, a transfer between two subscribed addresses appears twice.
+func flattenTransactions(batch map[string][]*model.ETHTransaction) []*model.ETHTransaction {
+	txs := make([]*model.ETHTransaction, 0)
+	for _, list := range batch {
+		txs = append(txs, list...)
+	}
+	return txs
+}
+
+// receiptInfo outcome and cost of tx from its receipt.
+// pre-London receipts and some providers omit effectiveGasPrice, the transaction gasPrice is what was paid then.
+func receiptInfo(receipt *model.ETHTransactionReceipt, tx *model.ETHTransaction) *model.ETHReceiptInfo {
+	info := &model.ETHReceiptInfo{
+		GasUsed:           receipt.GasUsed,
+		EffectiveGasPrice: receipt.EffectiveGasPrice,
+		ContractAddress:   receipt.ContractAddress,
+		BlobGasUsed:       receipt.BlobGasUsed,
+		BlobGasPrice:      receipt.BlobGasPrice,
+		Logs:              receipt.Logs,
+	}
+	if info.Logs == nil {
+		info.Logs = make([]*model.ETHLog, 0)
+	}
+	if info.EffectiveGasPrice == nil {
+		info.EffectiveGasPrice = tx.GasPrice
+	}
+	if receipt.Status != nil {
+		switch *receipt.Status {
+		case 1:
+			info.Status = model.RECEIPT_STATUS_SUCCESS
+		case 0:
+			info.Status = model.RECEIPT_STATUS_FAILED
+		}
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(uint64(receipt.GasUsed)), info.EffectiveGasPrice.Int())
+	if receipt.BlobGasUsed != nil {
+		fee.Add(fee, new(big.Int).Mul(new(big.Int).SetUint64(uint64(*receipt.BlobGasUsed)), receipt.BlobGasPrice.Int()))
+	}
+	info.Fee = model.NewWei(fee)
+	return info
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+// stubReceipts answer successful receipts of the transactions of blocks.
+func stubReceipts(blocks ...*model.ETHBlockInfo) fetchReceiptsFunc {
+	blockHashes := map[model.Hash]model.Hash{}
+	for _, blockInfo := range blocks {
+		for _, tx := range blockInfo.Transactions {
+			blockHashes[tx.Hash] = tx.BlockHash
+		}
+	}
+	success := model.Uint64(1)
+	return func(ctx context.Context, hashes []string) ([]*model.ETHTransactionReceipt, error) {
+		receipts := make([]*model.ETHTransactionReceipt, len(hashes))
+		for i, hash := range hashes {
+			receipts[i] = &model.ETHTransactionReceipt{TransactionHash: model.Hash(hash), BlockHash: blockHashes[model.Hash(hash)], Status: &success}
+		}
+		return receipts, nil
+	}
+}
+
+// decodeReceipt decode a JSON-RPC receipt.
+func decodeReceipt(t *testing.T, data string) *model.ETHTransactionReceipt {
+	receipt := &model.ETHTransactionReceipt{}
+	assert.Nil(t, json.Unmarshal([]byte(data), receipt))
+	return receipt
+}
+
+func TestReceiptInfo(t *testing.T) {
+	info := receiptInfo(decodeReceipt(t, `{"status":"0x0","gasUsed":"0x5208","effectiveGasPrice":"0x3b9aca00",
+		"blobGasUsed":"0x20000","blobGasPrice":"0x1","contractAddress":"0xAE2FC483527B8EF99EB5D9B44875F005BA1FAE13"}`), &model.ETHTransaction{})
+	assert.Equal(t, model.RECEIPT_STATUS_FAILED, info.Status)
+	// 21000 * 1 gwei + 131072 * 1 wei.
+	assert.Equal(t, "0x1319718c5000", info.Fee.String())
+	assert.Equal(t, model.Address("0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"), info.ContractAddress)
+	assert.Equal(t, 0, len(info.Logs))
+
+	info = receiptInfo(decodeReceipt(t, `{"status":"0x1","gasUsed":"0x5208","effectiveGasPrice":"0x1"}`), &model.ETHTransaction{})
+	assert.Equal(t, model.RECEIPT_STATUS_SUCCESS, info.Status)
+	assert.Equal(t, "0x5208", info.Fee.String())
+
+	// before Byzantium.
+	info = receiptInfo(decodeReceipt(t, `{"root":"0x01","gasUsed":"0x5208","effectiveGasPrice":"0x1"}`), &model.ETHTransaction{})
+	assert.Equal(t, "", info.Status)
+
+	// no effectiveGasPrice, the fee falls back to the transaction gas price.
+	tx := &model.ETHTransaction{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"hash":"0x1","gasPrice":"0x2"}`), tx))
+	info = receiptInfo(decodeReceipt(t, `{"root":"0x01","gasUsed":"0x5208"}`), tx)
+	assert.Equal(t, "0x2", info.EffectiveGasPrice.String())
+	assert.Equal(t, "0xa410", info.Fee.String())
+}
+
+func TestAttachReceipts(t *testing.T) {
+	ctx := context.Background()
+	tx := &model.ETHTransaction{Hash: "0x1", BlockHash: "0xa"}
+	moved := &model.ETHTransaction{Hash: "0x2", BlockHash: "0xc"}
+	stub := stubReceipts(&model.ETHBlockInfo{Transactions: []*model.ETHTransaction{tx, {Hash: "0x2", BlockHash: "0xb"}}})
+	calls := 0
+	fetch := func(ctx context.Context, hashes []string) ([]*model.ETHTransactionReceipt, error) {
+		calls++
+		return stub(ctx, hashes)
+	}
+	// the same transaction twice, inbound and outbound of two subscribed addresses.
+	assert.Nil(t, attachReceipts(ctx, fetch, []*model.ETHTransaction{tx, tx}))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, model.RECEIPT_STATUS_SUCCESS, tx.Receipt.Status)
+
+	// already attached, nothing fetched.
+	assert.Nil(t, attachReceipts(ctx, fetch, []*model.ETHTransaction{tx}))
+	assert.Equal(t, 1, calls)
+
+	// included in another block since.
+	err := attachReceipts(ctx, fetch, []*model.ETHTransaction{moved})
+	assert.NotNil(t, err)
+}
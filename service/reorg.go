@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// errRolledBack the last applied block was orphaned and rolled back, ingestion must restart from the cursor.
+var errRolledBack = errors.New("block rolled back")
+
+// maxReorgEvents how many reorg events are kept for API consumers.
+const maxReorgEvents = 100
+
+// windowBlock a block recently applied by the ingest loop.
+type windowBlock struct {
+	number     int64
+	hash       string
+	parentHash string
+	addrs      []string // subscribed addresses whose history got transactions of this block.
+}
+
+// blockWindow keep the most recent applied blocks, used to detect reorg and roll back.
+// it lives in memory only, blocks applied before a restart are not compared, so a reorg of them is neither detected nor rolled back.
+type blockWindow struct {
+	size   int
+	blocks []*windowBlock
+	base   *windowBlock // parent of the last block rolled back out of the emptied window.
+}
+
+func newBlockWindow(size int) *blockWindow {
+	if size <= 0 {
+		size = 1
+	}
+	return &blockWindow{size: size}
+}
+
+// Push append block, drop the oldest one if window is full.
+func (w *blockWindow) Push(b *windowBlock) {
+	w.blocks = append(w.blocks, b)
+	w.base = nil
+	if len(w.blocks) > w.size {
+		w.blocks = w.blocks[len(w.blocks)-w.size:]
+	}
+}
+
+// Last return the most recent block, nil if window is empty.
+func (w *blockWindow) Last() *windowBlock {
+	if len(w.blocks) == 0 {
+		return nil
+	}
+	return w.blocks[len(w.blocks)-1]
+}
+
+// Pop remove and return the most recent block, nil if window is empty.
+func (w *blockWindow) Pop() *windowBlock {
+	last := w.Last()
+	if last != nil {
+		w.blocks = w.blocks[:len(w.blocks)-1]
+		if len(w.blocks) == 0 {
+			w.base = &windowBlock{number: last.number - 1, hash: last.parentHash}
+		}
+	}
+	return last
+}
+
+// Find return the block at number, nil if it is not in the window.
+func (w *blockWindow) Find(number int64) *windowBlock {
+	for i := len(w.blocks) - 1; i >= 0; i-- {
+		if w.blocks[i].number == number {
+			return w.blocks[i]
+		}
+	}
+	return nil
+}
+
+// isReorg report whether blockInfo does not build on the last applied block.
+func (w *blockWindow) isReorg(number int64, blockInfo *model.ETHBlockInfo) bool {
+	parent := w.Last()
+	return parent != nil && parent.number == number-1 && parent.hash != string(blockInfo.ParentHash)
+}
+
+// isBeyond report whether blockInfo does not build on the parent of the window rolled back in full,
+// the fork is older than the window and the blocks before it cannot be rolled back.
+func (w *blockWindow) isBeyond(number int64, blockInfo *model.ETHBlockInfo) bool {
+	return w.base != nil && w.base.number == number-1 && w.base.hash != string(blockInfo.ParentHash)
+}
+
+// reorgLog recent reorg events.
+type reorgLog struct {
+	mutex  sync.RWMutex
+	events []*model.ETHReorgEvent
+}
+
+// Add record a reorg event.
+func (l *reorgLog) Add(ctx context.Context, event *model.ETHReorgEvent) {
+	log.Println(ctx, "[reorgLog]: chain reorg, block number:", event.BlockNumber, "depth:", event.Depth, "orphaned:", event.OrphanedBlocks, "unrecoverable:", event.Unrecoverable)
+	l.mutex.Lock()
+	l.events = append(l.events, event)
+	if len(l.events) > maxReorgEvents {
+		l.events = l.events[len(l.events)-maxReorgEvents:]
+	}
+	l.mutex.Unlock()
+}
+
+// List return recent reorg events, newest first.
+func (l *reorgLog) List() []*model.ETHReorgEvent {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	events := make([]*model.ETHReorgEvent, 0, len(l.events))
+	for i := len(l.events) - 1; i >= 0; i-- {
+		events = append(events, l.events[i])
+	}
+	return events
+}
+
+// rollback remove the last applied block, its transactions, token and internal transfers and withdrawals from subscribed histories.
+// it returns the orphaned block, nil if the window is exhausted.
+func (s *ETHService) rollback(ctx context.Context, event *model.ETHReorgEvent) (*windowBlock, error) {
+	orphan := s.window.Last()
+	if orphan == nil {
+		return nil, nil
+	}
+	// a transaction between two subscribed addresses, or moving ether and emitting transfers, is reported once.
+	removedTxs := make([]string, 0)
+	for _, addr := range orphan.addrs {
+		removed, err := s.store.RemoveBlockTransactions(ctx, addr, orphan.number, orphan.hash)
+		if err != nil {
+			log.Println(ctx, "[rollback]: Error RemoveBlockTransactions, err: ", err)
+			return nil, err
+		}
+		removedTxs = appendMissing(removedTxs, removed...)
+		removed, err = s.store.RemoveBlockTokenTransfers(ctx, addr, orphan.number, orphan.hash)
+		if err != nil {
+			log.Println(ctx, "[rollback]: Error RemoveBlockTokenTransfers, err: ", err)
+			return nil, err
+		}
+		removedTxs = appendMissing(removedTxs, removed...)
+		removed, err = s.store.RemoveBlockInternalTransfers(ctx, addr, orphan.number, orphan.hash)
+		if err != nil {
+			log.Println(ctx, "[rollback]: Error RemoveBlockInternalTransfers, err: ", err)
+			return nil, err
+		}
+		removedTxs = appendMissing(removedTxs, removed...)
+		removed, err = s.store.RemoveBlockWithdrawals(ctx, addr, orphan.number, orphan.hash)
+		if err != nil {
+			log.Println(ctx, "[rollback]: Error RemoveBlockWithdrawals, err: ", err)
+			return nil, err
+		}
+		event.RemovedWithdrawals = append(event.RemovedWithdrawals, removed...)
+	}
+	// pop only once the block is fully removed, a failed rollback is retried next tick.
+	s.window.Pop()
+	event.RemovedTransactions = append(event.RemovedTransactions, removedTxs...)
+	s.publishRemoved(orphan, removedTxs)
+	event.Depth++
+	event.OrphanedBlocks = append(event.OrphanedBlocks, orphan.hash)
+	log.Println(ctx, "[rollback]: orphaned block:", orphan.number, orphan.hash)
+	return orphan, nil
+}
+
+// newReorgEvent start a reorg event detected at block number.
+func newReorgEvent(number int64) *model.ETHReorgEvent {
+	return &model.ETHReorgEvent{
+		DetectedAt:          time.Now().Unix(),
+		BlockNumber:         number,
+		OrphanedBlocks:      []string{},
+		RemovedTransactions: []string{},
+		RemovedWithdrawals:  []string{},
+	}
+}
+
+// appendMissing append hashes not already in list.
+func appendMissing(list []string, hashes ...string) []string {
+	for _, hash := range hashes {
+		found := false
+		for _, existing := range list {
+			if existing == hash {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, hash)
+		}
+	}
+	return list
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/storage"
+	"github.com/tj/assert"
+)
+
+func TestBlockWindow_IsReorg(t *testing.T) {
+	window := newBlockWindow(2)
+	window.Push(&windowBlock{number: 10, hash: "0xa"})
+	window.Push(&windowBlock{number: 11, hash: "0xb", parentHash: "0xa"})
+	window.Push(&windowBlock{number: 12, hash: "0xc", parentHash: "0xb"})
+	assert.Equal(t, 2, len(window.blocks))
+	assert.Equal(t, false, window.isReorg(13, &model.ETHBlockInfo{ParentHash: "0xc"}))
+	assert.Equal(t, true, window.isReorg(13, &model.ETHBlockInfo{ParentHash: "0xd"}))
+	// unrelated height, nothing to compare with.
+	assert.Equal(t, false, window.isReorg(20, &model.ETHBlockInfo{ParentHash: "0xd"}))
+}
+
+func TestBlockWindow_IsBeyond(t *testing.T) {
+	window := newBlockWindow(2)
+	window.Push(&windowBlock{number: 11, hash: "0xb", parentHash: "0xa"})
+	window.Push(&windowBlock{number: 12, hash: "0xc", parentHash: "0xb"})
+	assert.Equal(t, false, window.isBeyond(11, &model.ETHBlockInfo{ParentHash: "0x99"}))
+	window.Pop()
+	window.Pop()
+	// the whole window was orphaned, the block must still build on its parent.
+	assert.Equal(t, false, window.isBeyond(11, &model.ETHBlockInfo{ParentHash: "0xa"}))
+	assert.Equal(t, true, window.isBeyond(11, &model.ETHBlockInfo{ParentHash: "0x99"}))
+	window.Push(&windowBlock{number: 11, hash: "0xd", parentHash: "0x99"})
+	assert.Equal(t, false, window.isBeyond(11, &model.ETHBlockInfo{ParentHash: "0x99"}))
+}
+
+func TestETHService_Rollback(t *testing.T) {
+	ctx := context.Background()
+	const addr = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	s := &ETHService{
+		subAddrs: map[string]bool{addr: true},
+		store:    storage.NewMemoryStorage(""),
+		window:   newBlockWindow(8),
+		reorgs:   &reorgLog{},
+	}
+	blocks := []*model.ETHBlockInfo{
+		{Hash: "0xa", Transactions: []*model.ETHTransaction{{Hash: "0x1", BlockHash: "0xa", BlockNumber: 0xa, From: addr}}},
+		{Hash: "0xb", Number: 0xb, ParentHash: "0xa", Transactions: []*model.ETHTransaction{{Hash: "0x2", BlockHash: "0xb", BlockNumber: 0xb, To: addr}},
+			Withdrawals: []*model.ETHWithdraw{{Index: 0x7, Address: addr, Amount: 1}}},
+	}
+	s.receipts = stubReceipts(blocks...)
+	for i, blockInfo := range blocks {
+		addrs, err := s.applyBlock(ctx, blockInfo)
+		assert.Nil(t, err)
+		s.window.Push(&windowBlock{number: int64(10 + i), hash: string(blockInfo.Hash), parentHash: string(blockInfo.ParentHash), addrs: addrs})
+	}
+	list, err := s.store.GetTransactions(ctx, addr)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list))
+
+	event := newReorgEvent(12)
+	orphan, err := s.rollback(ctx, event)
+	assert.Nil(t, err)
+	assert.NotNil(t, orphan)
+	assert.Equal(t, int64(11), orphan.number)
+	assert.Equal(t, 1, event.Depth)
+	assert.Equal(t, []string{"0x2"}, event.RemovedTransactions)
+	assert.Equal(t, []string{"0x7"}, event.RemovedWithdrawals)
+	list, err = s.store.GetTransactions(ctx, addr)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, model.Hash("0x1"), list[0].Hash)
+}
+
+func TestETHService_BackfillRollback(t *testing.T) {
+	ctx := context.Background()
+	const contract = "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	s := &ETHService{
+		subAddrs: map[string]bool{},
+		store:    storage.NewMemoryStorage(""),
+		window:   newBlockWindow(8),
+		reorgs:   &reorgLog{},
+	}
+	// the contract is deployed by an unsubscribed address, its creation only matches through the receipt.
+	blockInfo := &model.ETHBlockInfo{Hash: "0xb", Number: 0xb, Transactions: []*model.ETHTransaction{
+		{Hash: "0x2", BlockHash: "0xb", BlockNumber: 0xb, From: "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"},
+	}}
+	success := model.Uint64(1)
+	s.receipts = func(ctx context.Context, hashes []string) ([]*model.ETHTransactionReceipt, error) {
+		return []*model.ETHTransactionReceipt{{TransactionHash: "0x2", BlockHash: "0xb", Status: &success, ContractAddress: contract}}, nil
+	}
+	// applied before the contract was subscribed.
+	addrs, err := s.applyBlock(ctx, blockInfo)
+	assert.Nil(t, err)
+	s.window.Push(&windowBlock{number: 11, hash: "0xb", addrs: addrs})
+	s.recentBlockNumer = 11
+	s.subAddrs[contract] = true
+
+	found, _, err := s.backfillBlock(ctx, contract, blockInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, found)
+	assert.Equal(t, []string{contract}, s.window.Find(11).addrs)
+	// not applied yet, left to live ingestion.
+	found, _, err = s.backfillBlock(ctx, contract, &model.ETHBlockInfo{Hash: "0xc", Number: 0xc, ParentHash: "0xb"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, found)
+
+	event := newReorgEvent(12)
+	_, err = s.rollback(ctx, event)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0x2"}, event.RemovedTransactions)
+	list, err := s.store.GetTransactions(ctx, contract)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(list))
+}
+
+func TestETHService_RollbackBetweenSubscribed(t *testing.T) {
+	ctx := context.Background()
+	const from, to = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13", "0x52908400098527886e0f7030069857d2e4169ee7"
+	s := &ETHService{
+		subAddrs: map[string]bool{from: true, to: true},
+		store:    storage.NewMemoryStorage(""),
+		window:   newBlockWindow(8),
+		reorgs:   &reorgLog{},
+	}
+	blockInfo := &model.ETHBlockInfo{Hash: "0xb", Transactions: []*model.ETHTransaction{{Hash: "0x2", BlockHash: "0xb", BlockNumber: 0xb, From: from, To: to}}}
+	s.receipts = stubReceipts(blockInfo)
+	addrs, err := s.applyBlock(ctx, blockInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(addrs))
+	s.window.Push(&windowBlock{number: 11, hash: "0xb", addrs: addrs})
+
+	// the transaction is in both histories but removed once.
+	event := newReorgEvent(12)
+	_, err = s.rollback(ctx, event)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0x2"}, event.RemovedTransactions)
+}
+
+func TestETHService_ReorgAcrossTicks(t *testing.T) {
+	ctx := context.Background()
+	s := &ETHService{
+		subAddrs: map[string]bool{},
+		store:    storage.NewMemoryStorage(""),
+		window:   newBlockWindow(8),
+		reorgs:   &reorgLog{},
+	}
+	assert.Nil(t, s.ingestBlock(ctx, 10, &model.ETHBlockInfo{Number: 0xa, Hash: "0xa"}))
+	assert.Nil(t, s.ingestBlock(ctx, 11, &model.ETHBlockInfo{Number: 0xb, Hash: "0xb", ParentHash: "0xa"}))
+	assert.Equal(t, errRolledBack, s.ingestBlock(ctx, 12, &model.ETHBlockInfo{Number: 0xc, Hash: "0xc", ParentHash: "0xbb"}))
+	assert.Equal(t, int64(10), s.recentBlockNumer)
+	// fetching the canonical block failed, the next tick applies it.
+	assert.Equal(t, 0, len(s.reorgs.List()))
+	assert.Nil(t, s.ingestBlock(ctx, 11, &model.ETHBlockInfo{Number: 0xb, Hash: "0xbb", ParentHash: "0xa"}))
+	events := s.reorgs.List()
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, int64(11), events[0].BlockNumber)
+	assert.Equal(t, int64(10), events[0].CommonAncestor)
+	assert.Equal(t, []string{"0xb"}, events[0].OrphanedBlocks)
+}
+
+func TestETHService_ReorgDeeperThanWindow(t *testing.T) {
+	ctx := context.Background()
+	s := &ETHService{
+		subAddrs: map[string]bool{},
+		store:    storage.NewMemoryStorage(""),
+		window:   newBlockWindow(2),
+		reorgs:   &reorgLog{},
+	}
+	assert.Nil(t, s.ingestBlock(ctx, 10, &model.ETHBlockInfo{Number: 0xa, Hash: "0xa", ParentHash: "0x9"}))
+	assert.Nil(t, s.ingestBlock(ctx, 11, &model.ETHBlockInfo{Number: 0xb, Hash: "0xb", ParentHash: "0xa"}))
+	assert.Equal(t, errRolledBack, s.ingestBlock(ctx, 12, &model.ETHBlockInfo{Number: 0xc, Hash: "0xcc", ParentHash: "0xbb"}))
+	assert.Equal(t, errRolledBack, s.ingestBlock(ctx, 11, &model.ETHBlockInfo{Number: 0xb, Hash: "0xbb", ParentHash: "0xaa"}))
+	// the window is empty and block 9 was orphaned too.
+	assert.Nil(t, s.ingestBlock(ctx, 10, &model.ETHBlockInfo{Number: 0xa, Hash: "0xaa", ParentHash: "0x99"}))
+	events := s.reorgs.List()
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, true, events[0].Unrecoverable)
+	assert.Equal(t, int64(-1), events[0].CommonAncestor)
+	assert.Equal(t, 2, events[0].Depth)
+	assert.Equal(t, []string{"0xb", "0xa"}, events[0].OrphanedBlocks)
+}
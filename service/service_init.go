@@ -1,5 +1,12 @@
 package service
 
+import "context"
+
 func Init()  {
 	ETHServiceInstance()
 }
+
+// Close release the service on shutdown.
+func Close() {
+	ETHServiceInstance().Close(context.Background())
+}
\ No newline at end of file
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/storage"
+)
+
+// errStreamLagging the client read slower than blocks were applied and its stream was dropped.
+var errStreamLagging = errors.New("stream fell behind, reconnect with the last event id")
+
+// txStream transactions of some addresses applied by live ingestion, one block per item.
+type txStream struct {
+	addrs  map[string]bool
+	blocks chan []*model.ETHTransaction
+}
+
+// txHub fan out the transactions of applied blocks to open streams.
+type txHub struct {
+	mutex   sync.Mutex
+	streams map[*txStream]bool
+	buffer  int // blocks a stream may lag behind before it is dropped.
+}
+
+func newTxHub(buffer int) *txHub {
+	return &txHub{streams: map[*txStream]bool{}, buffer: buffer}
+}
+
+// add open a stream of addrs.
+func (h *txHub) add(addrs map[string]bool) *txStream {
+	stream := &txStream{addrs: addrs, blocks: make(chan []*model.ETHTransaction, h.buffer)}
+	h.mutex.Lock()
+	h.streams[stream] = true
+	h.mutex.Unlock()
+	return stream
+}
+
+// remove close stream if it is still open.
+func (h *txHub) remove(stream *txStream) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.streams[stream] {
+		delete(h.streams, stream)
+		close(stream.blocks)
+	}
+}
+
+// publish push the transactions of an applied block to the streams of their addresses,
+// a stream whose buffer is full is dropped rather than blocking ingestion. a nil hub has no stream.
+func (h *txHub) publish(txs []*model.ETHTransaction) {
+	if h == nil || len(txs) == 0 {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for stream := range h.streams {
+		matched := make([]*model.ETHTransaction, 0)
+		for _, tx := range txs {
+			if len(matchAddresses(stream.addrs, tx)) > 0 {
+				matched = append(matched, tx)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		select {
+		case stream.blocks <- sortTransactions(matched):
+		default:
+			delete(h.streams, stream)
+			close(stream.blocks)
+		}
+	}
+}
+
+// matchAddresses addresses of addrs tx is sent from, to or creates.
+func matchAddresses(addrs map[string]bool, tx *model.ETHTransaction) []model.Address {
+	matched := make([]model.Address, 0, 2)
+	for _, addr := range []model.Address{tx.From, tx.To, tx.ContractCreated} {
+		if len(addr) == 0 || !addrs[string(addr)] {
+			continue
+		}
+		if len(matched) == 0 || matched[len(matched)-1] != addr {
+			matched = append(matched, addr)
+		}
+	}
+	return matched
+}
+
+// txBefore report whether a comes before b in chain order, the order of storage.TxCursor.
+func txBefore(a, b *model.ETHTransaction) bool {
+	if a.BlockNumber != b.BlockNumber {
+		return a.BlockNumber < b.BlockNumber
+	}
+	if a.TransactionIndex != b.TransactionIndex {
+		return a.TransactionIndex < b.TransactionIndex
+	}
+	return a.Hash < b.Hash
+}
+
+// sortTransactions put txs in chain order and drop repeated ones, a transaction is stored once per matched address.
+func sortTransactions(txs []*model.ETHTransaction) []*model.ETHTransaction {
+	sort.Slice(txs, func(i, j int) bool {
+		return txBefore(txs[i], txs[j])
+	})
+	list := txs[:0]
+	for _, tx := range txs {
+		if len(list) == 0 || list[len(list)-1].Hash != tx.Hash {
+			list = append(list, tx)
+		}
+	}
+	return list
+}
+
+// StreamTransactions send transactions of addresses in chain order as live ingestion applies their blocks,
+// until ctx is done or the client falls behind. with lastEventID, stored transactions after that event are sent first.
+// send is called with nil once the stream is open and on every heartbeat, so the caller can keep the connection alive.
+func (s *ETHService) StreamTransactions(ctx context.Context, addresses []string, lastEventID string, send func(*model.ETHTxEvent) error) error {
+	if len(addresses) == 0 {
+		return errors.New("no address to stream")
+	}
+	addrs := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		address = strings.ToLower(address)
+		if _, ok, err := s.store.GetSubscription(ctx, address); err != nil || !ok {
+			if err == nil {
+				err = fmt.Errorf("%s: %w", address, errNotSubscribed)
+			}
+			log.Println(ctx, "[StreamTransactions]: Error GetSubscription, err: ", err)
+			return err
+		}
+		addrs[address] = true
+	}
+	stream, err := s.openStream(ctx, addrs, lastEventID, send)
+	if err != nil {
+		log.Println(ctx, "[StreamTransactions]: Error openStream, err: ", err)
+		return err
+	}
+	defer s.streams.remove(stream)
+	heartbeat := time.NewTicker(s.streamHeartbeat)
+	defer heartbeat.Stop()
+	if err := send(nil); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			err = send(nil)
+		case txs, ok := <-stream.blocks:
+			if !ok {
+				log.Println(ctx, "[StreamTransactions]: stream dropped, addresses:", len(addrs))
+				return errStreamLagging
+			}
+			err = s.sendTransactions(ctx, addrs, txs, send)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// openStream replay stored transactions of addrs after lastEventID, then open their live stream.
+// the tail of the replay is read under the ingest lock, so no block is applied between it and the live stream.
+func (s *ETHService) openStream(ctx context.Context, addrs map[string]bool, lastEventID string, send func(*model.ETHTxEvent) error) (*txStream, error) {
+	if len(lastEventID) == 0 {
+		return s.streams.add(addrs), nil
+	}
+	cursor, err := s.replayTransactions(ctx, addrs, lastEventID, send)
+	if err != nil {
+		return nil, err
+	}
+	// only collect the tail while locked, a slow client must not hold up ingestion.
+	tail := make([]*model.ETHTxEvent, 0)
+	s.ingestMutex.Lock()
+	_, err = s.replayTransactions(ctx, addrs, cursor, func(event *model.ETHTxEvent) error {
+		tail = append(tail, event)
+		return nil
+	})
+	var stream *txStream
+	if err == nil {
+		stream = s.streams.add(addrs)
+	}
+	s.ingestMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range tail {
+		if err := send(event); err != nil {
+			s.streams.remove(stream)
+			return nil, err
+		}
+	}
+	return stream, nil
+}
+
+// replayTransactions send stored transactions of addrs after the one of cursor in chain order,
+// return the cursor of the last one sent, or cursor itself if none.
+func (s *ETHService) replayTransactions(ctx context.Context, addrs map[string]bool, cursor string, send func(*model.ETHTxEvent) error) (string, error) {
+	for {
+		txs := make([]*model.ETHTransaction, 0)
+		// last transaction of the earliest ending full page, an address of a full page may have more before later ones.
+		var bound *model.ETHTransaction
+		for address := range addrs {
+			query := &model.ETHTxQuery{Cursor: cursor, Limit: model.MAX_PAGE_LIMIT, Order: model.ORDER_ASC}
+			list, next, err := s.store.QueryTransactions(ctx, address, query)
+			if err != nil {
+				log.Println(ctx, "[replayTransactions]: Error store QueryTransactions, err: ", err)
+				return "", err
+			}
+			txs = append(txs, list...)
+			if last := len(list) - 1; len(next) > 0 && (bound == nil || txBefore(list[last], bound)) {
+				bound = list[last]
+			}
+		}
+		txs = sortTransactions(txs)
+		if bound != nil {
+			for i, tx := range txs {
+				if txBefore(bound, tx) {
+					txs = txs[:i]
+					break
+				}
+			}
+		}
+		if len(txs) == 0 {
+			return cursor, nil
+		}
+		if err := s.sendTransactions(ctx, addrs, txs, send); err != nil {
+			return "", err
+		}
+		cursor = storage.TxCursor(txs[len(txs)-1])
+		if bound == nil {
+			return cursor, nil
+		}
+	}
+}
+
+// sendTransactions send txs in order as events of the streamed addrs.
+func (s *ETHService) sendTransactions(ctx context.Context, addrs map[string]bool, txs []*model.ETHTransaction, send func(*model.ETHTxEvent) error) error {
+	for i, item := range s.withStatus(ctx, txs) {
+		event := &model.ETHTxEvent{
+			ID:          storage.TxCursor(txs[i]),
+			Addresses:   matchAddresses(addrs, txs[i]),
+			Transaction: item,
+		}
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
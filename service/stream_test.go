@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/storage"
+	"github.com/tj/assert"
+)
+
+func TestETHService_StreamTransactions(t *testing.T) {
+	ctx := context.Background()
+	const (
+		a     = "0x70997970c51812dc3a010c7d01b50e0d17dc79c8"
+		b     = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+		other = "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	)
+	s := &ETHService{
+		subAddrs:        map[string]bool{},
+		store:           storage.NewMemoryStorage(""),
+		streams:         newTxHub(8),
+		streamHeartbeat: time.Hour,
+	}
+	for _, addr := range []string{a, b} {
+		assert.Nil(t, s.Subscribe(ctx, addr))
+	}
+	blocks := []*model.ETHBlockInfo{
+		{Number: 0x65, Hash: "0xb1", Transactions: []*model.ETHTransaction{
+			{Hash: "0x1", BlockHash: "0xb1", BlockNumber: 0x65, From: a, To: b},
+			{Hash: "0x2", BlockHash: "0xb1", BlockNumber: 0x65, TransactionIndex: 1, From: b, To: other},
+		}},
+		{Number: 0x66, Hash: "0xb2", Transactions: []*model.ETHTransaction{
+			{Hash: "0x3", BlockHash: "0xb2", BlockNumber: 0x66, From: other, To: a},
+		}},
+		{Number: 0x67, Hash: "0xb3", Transactions: []*model.ETHTransaction{
+			{Hash: "0x4", BlockHash: "0xb3", BlockNumber: 0x67, From: a, To: a},
+			{Hash: "0x5", BlockHash: "0xb3", BlockNumber: 0x67, TransactionIndex: 1, From: other, To: other},
+		}},
+	}
+	s.receipts = stubReceipts(blocks...)
+	for _, blockInfo := range blocks[:2] {
+		_, err := s.applyBlock(ctx, blockInfo)
+		assert.Nil(t, err)
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	events := make(chan *model.ETHTxEvent, 8)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.StreamTransactions(streamCtx, []string{a, b}, storage.TxCursor(blocks[0].Transactions[0]), func(event *model.ETHTxEvent) error {
+			events <- event
+			return nil
+		})
+	}()
+	// stored transactions after the last event, then the stream opens.
+	for _, hash := range []model.Hash{"0x2", "0x3"} {
+		event := <-events
+		assert.Equal(t, hash, event.Transaction.Hash)
+		assert.Equal(t, storage.TxCursor(event.Transaction.ETHTransaction), event.ID)
+	}
+	assert.Nil(t, <-events)
+
+	// live transactions, one event per transaction.
+	_, err := s.applyBlock(ctx, blocks[2])
+	assert.Nil(t, err)
+	event := <-events
+	assert.Equal(t, model.Hash("0x4"), event.Transaction.Hash)
+	assert.Equal(t, []model.Address{a}, event.Addresses)
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Equal(t, 0, len(events))
+
+	err = s.StreamTransactions(ctx, []string{a, other}, "", nil)
+	assert.True(t, errors.Is(err, errNotSubscribed))
+	err = s.StreamTransactions(ctx, []string{a}, "bad", nil)
+	assert.Equal(t, storage.ErrInvalidCursor, err)
+}
+
+func TestETHService_ReplayTransactions(t *testing.T) {
+	ctx := context.Background()
+	const (
+		a = "0x70997970c51812dc3a010c7d01b50e0d17dc79c8"
+		b = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	)
+	s := &ETHService{store: storage.NewMemoryStorage("")}
+	// more transactions of a than a page, b's fall between them.
+	batch := map[string][]*model.ETHTransaction{}
+	for i := 1; i <= model.MAX_PAGE_LIMIT+500; i++ {
+		batch[a] = append(batch[a], &model.ETHTransaction{Hash: model.Hash(fmt.Sprintf("0xa%d", i)), BlockNumber: model.Uint64(i), From: a})
+	}
+	batch[b] = []*model.ETHTransaction{
+		{Hash: "0xb1", BlockNumber: 700, TransactionIndex: 1, To: b},
+		{Hash: "0xb2", BlockNumber: 2000, To: b},
+	}
+	assert.Nil(t, s.store.AppendBlock(ctx, &storage.BlockBatch{Transactions: batch}))
+
+	var last *model.ETHTransaction
+	count := 0
+	cursor, err := s.replayTransactions(ctx, map[string]bool{a: true, b: true}, "", func(event *model.ETHTxEvent) error {
+		if last != nil {
+			assert.True(t, txBefore(last, event.Transaction.ETHTransaction), event.ID)
+		}
+		last = event.Transaction.ETHTransaction
+		count++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, model.MAX_PAGE_LIMIT+502, count)
+	assert.Equal(t, model.Hash("0xb2"), last.Hash)
+	assert.Equal(t, storage.TxCursor(last), cursor)
+}
+
+func TestTxHub_DropLagging(t *testing.T) {
+	const addr = "0x70997970c51812dc3a010c7d01b50e0d17dc79c8"
+	hub := newTxHub(1)
+	stream := hub.add(map[string]bool{addr: true})
+	hub.publish([]*model.ETHTransaction{{Hash: "0x1", From: "0x1"}})
+	assert.Equal(t, 0, len(stream.blocks))
+	hub.publish([]*model.ETHTransaction{{Hash: "0x2", To: addr}, {Hash: "0x2", To: addr}})
+	hub.publish([]*model.ETHTransaction{{Hash: "0x3", From: addr}})
+	txs, ok := <-stream.blocks
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(txs))
+	_, ok = <-stream.blocks
+	assert.False(t, ok)
+	// removing a dropped stream is a no-op.
+	hub.remove(stream)
+}
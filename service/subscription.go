@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/util"
+)
+
+var (
+	// errNotSubscribed the address has no subscription.
+	errNotSubscribed = errors.New("address not subscribed")
+	// errUnsubscribed the address was unsubscribed while its backfill job was running.
+	errUnsubscribed = errors.New("address unsubscribed")
+)
+
+// newSubscription subscription of address described by req,
+// an existing subscription keeps its creation time and start block, only a non-empty label or owner replaces the stored one.
+func (s *ETHService) newSubscription(ctx context.Context, address string, startBlock int64, req *model.ETHSubscribeRequest) (*model.ETHSubscription, error) {
+	sub, ok, err := s.store.GetSubscription(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		sub = &model.ETHSubscription{
+			Address:    model.Address(address),
+			CreatedAt:  time.Now().Unix(),
+			StartBlock: startBlock,
+		}
+	}
+	if len(req.Label) > 0 {
+		sub.Label = req.Label
+	}
+	if len(req.Owner) > 0 {
+		sub.Owner = req.Owner
+	}
+	return sub, nil
+}
+
+// BulkSubscribeLimit most addresses accepted by one BulkSubscribe.
+func (s *ETHService) BulkSubscribeLimit() int {
+	return s.bulkSubscribeLimit
+}
+
+// BulkSubscribe subscribe the addresses of reqs, an invalid or repeated address fails alone
+// while the others are subscribed, history is not backfilled.
+// the ingest loop is held for the whole import, so a block is matched against either none or all of the new addresses.
+func (s *ETHService) BulkSubscribe(ctx context.Context, reqs []*model.ETHSubscribeRequest) (*model.ETHBulkSubscribeResult, error) {
+	if len(reqs) == 0 {
+		return nil, errors.New("no address to subscribe")
+	}
+	if len(reqs) > s.bulkSubscribeLimit {
+		return nil, fmt.Errorf("%d addresses exceed the bulk subscribe limit %d", len(reqs), s.bulkSubscribeLimit)
+	}
+	s.ingestMutex.Lock()
+	defer s.ingestMutex.Unlock()
+	startBlock := atomic.LoadInt64(&s.recentBlockNumer) + 1
+	result := &model.ETHBulkSubscribeResult{Results: make([]*model.ETHSubscribeResult, 0, len(reqs))}
+	subs := make([]*model.ETHSubscription, 0, len(reqs))
+	seen := map[string]bool{}
+	for _, req := range reqs {
+		address, err := util.ParseAddress(strings.TrimSpace(req.Address))
+		item := &model.ETHSubscribeResult{Address: model.Address(address)}
+		result.Results = append(result.Results, item)
+		switch {
+		case err != nil:
+			item.Address, item.Error = model.Address(req.Address), err.Error()
+		case seen[address]:
+			item.Error = "duplicate address"
+		}
+		if len(item.Error) > 0 {
+			result.Failed++
+			continue
+		}
+		seen[address] = true
+		sub, err := s.newSubscription(ctx, address, startBlock, req)
+		if err != nil {
+			log.Println(ctx, "[BulkSubscribe]: Error newSubscription, err: ", err)
+			return nil, err
+		}
+		subs = append(subs, sub)
+		item.OK = true
+	}
+	if len(subs) == 0 {
+		return result, nil
+	}
+	if err := s.store.PutSubscriptions(ctx, subs); err != nil {
+		log.Println(ctx, "[BulkSubscribe]: Error PutSubscriptions, err: ", err)
+		return nil, err
+	}
+	s.addrRWMutex.Lock()
+	for _, sub := range subs {
+		s.subAddrs[string(sub.Address)] = true
+	}
+	s.addrRWMutex.Unlock()
+	result.Subscribed = len(subs)
+	log.Println(ctx, "[BulkSubscribe]: subscribed:", result.Subscribed, "failed:", result.Failed)
+	return result, nil
+}
+
+// GetSubscription get the subscription of address.
+func (s *ETHService) GetSubscription(ctx context.Context, address string) (*model.ETHSubscription, error) {
+	sub, ok, err := s.store.GetSubscription(ctx, strings.ToLower(address))
+	if err != nil {
+		log.Println(ctx, "[GetSubscription]: Error store GetSubscription, err: ", err)
+		return nil, err
+	}
+	if !ok {
+		return nil, errNotSubscribed
+	}
+	return sub, nil
+}
+
+// ListSubscriptions list a page of subscriptions ordered by address, of one owner if owner is not empty,
+// cursor is the nextCursor of the previous page.
+func (s *ETHService) ListSubscriptions(ctx context.Context, owner, cursor string, limit int) (*model.ETHSubscriptionPage, error) {
+	switch {
+	case limit == 0:
+		limit = model.DEFAULT_PAGE_LIMIT
+	case limit < 0 || limit > model.MAX_PAGE_LIMIT:
+		return nil, fmt.Errorf("limit must be between 1 and %d", model.MAX_PAGE_LIMIT)
+	}
+	if len(cursor) > 0 {
+		// the cursor may come back checksummed, addresses are stored lowercased.
+		address, err := util.ParseAddress(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		cursor = address
+	}
+	subs, next, err := s.store.QuerySubscriptions(ctx, owner, cursor, limit)
+	if err != nil {
+		log.Println(ctx, "[ListSubscriptions]: Error store QuerySubscriptions, err: ", err)
+		return nil, err
+	}
+	return &model.ETHSubscriptionPage{Subscriptions: subs, NextCursor: next}, nil
+}
+
+// Unsubscribe stop tracking address, purge also delete its stored history.
+// a running backfill job of the address fails on its next block.
+func (s *ETHService) Unsubscribe(ctx context.Context, address string, purge bool) error {
+	address = strings.ToLower(address)
+	// wait for the block being applied, the next one no longer matches address.
+	s.ingestMutex.Lock()
+	defer s.ingestMutex.Unlock()
+	if _, ok, err := s.store.GetSubscription(ctx, address); err != nil || !ok {
+		if err == nil {
+			err = errNotSubscribed
+		}
+		log.Println(ctx, "[Unsubscribe]: Error GetSubscription, err: ", err)
+		return err
+	}
+	if err := s.store.DeleteSubscription(ctx, address, purge); err != nil {
+		log.Println(ctx, "[Unsubscribe]: Error DeleteSubscription, err: ", err)
+		return err
+	}
+	s.addrRWMutex.Lock()
+	delete(s.subAddrs, address)
+	s.addrRWMutex.Unlock()
+	log.Println(ctx, "[Unsubscribe]: unsubscribed address:", address, "purge:", purge)
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/storage"
+	"github.com/sugarshop/token-gateway/util"
+	"github.com/tj/assert"
+)
+
+func TestETHService_Subscriptions(t *testing.T) {
+	ctx := context.Background()
+	s := &ETHService{subAddrs: map[string]bool{}, store: storage.NewMemoryStorage("")}
+	addrs := []string{
+		"0x70997970c51812dc3a010c7d01b50e0d17dc79c8",
+		"0xae2fc483527b8ef99eb5d9b44875f005ba1fae13",
+		"0x5fbdb2315678afecb367f032d93f642f64180aa3",
+	}
+	for i, addr := range addrs {
+		owner := "payments"
+		if i == 1 {
+			owner = "treasury"
+		}
+		_, err := s.SubscribeFrom(ctx, &model.ETHSubscribeRequest{Address: addr, FromBlock: -1, Label: "wallet", Owner: owner})
+		assert.Nil(t, err)
+	}
+	sub, err := s.GetSubscription(ctx, "0xae2Fc483527B8EF99EB5D9B44875F005ba1FaE13")
+	assert.Nil(t, err)
+	assert.Equal(t, "treasury", sub.Owner)
+	createdAt, startBlock := sub.CreatedAt, sub.StartBlock
+
+	// subscribing again only replaces label and owner.
+	s.recentBlockNumer = 100
+	_, err = s.SubscribeFrom(ctx, &model.ETHSubscribeRequest{Address: addrs[1], FromBlock: -1, Label: "cold wallet", Owner: "treasury"})
+	assert.Nil(t, err)
+	sub, err = s.GetSubscription(ctx, addrs[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "cold wallet", sub.Label)
+	assert.Equal(t, createdAt, sub.CreatedAt)
+	assert.Equal(t, startBlock, sub.StartBlock)
+	// an empty label or owner keeps the stored one.
+	_, err = s.SubscribeFrom(ctx, &model.ETHSubscribeRequest{Address: addrs[1], FromBlock: -1})
+	assert.Nil(t, err)
+	sub, err = s.GetSubscription(ctx, addrs[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "cold wallet", sub.Label)
+	assert.Equal(t, "treasury", sub.Owner)
+
+	page, err := s.ListSubscriptions(ctx, "", "", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Subscriptions))
+	assert.Equal(t, model.Address(addrs[2]), page.Subscriptions[0].Address)
+	assert.Equal(t, model.Address(addrs[0]), page.Subscriptions[1].Address)
+	// a cursor sent back checksummed pages the same.
+	page, err = s.ListSubscriptions(ctx, "", util.ChecksumAddress(page.NextCursor), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(page.Subscriptions))
+	assert.Equal(t, model.Address(addrs[1]), page.Subscriptions[0].Address)
+	assert.Equal(t, "", page.NextCursor)
+	page, err = s.ListSubscriptions(ctx, "payments", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Subscriptions))
+	_, err = s.ListSubscriptions(ctx, "", "", model.MAX_PAGE_LIMIT+1)
+	assert.NotNil(t, err)
+	_, err = s.ListSubscriptions(ctx, "", "0xnot", 2)
+	assert.NotNil(t, err)
+
+	// history is kept unless purged.
+	blockInfo := &model.ETHBlockInfo{Number: 0x65, Hash: "0xb", Transactions: []*model.ETHTransaction{
+		{Hash: "0x1", BlockHash: "0xb", BlockNumber: 0x65, From: model.Address(addrs[0]), To: model.Address(addrs[1])},
+	}}
+	s.receipts = stubReceipts(blockInfo)
+	_, err = s.applyBlock(ctx, blockInfo)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Unsubscribe(ctx, addrs[0], false))
+	assert.Nil(t, s.Unsubscribe(ctx, addrs[1], true))
+	assert.Equal(t, errNotSubscribed, s.Unsubscribe(ctx, addrs[1], true))
+	_, err = s.GetSubscription(ctx, addrs[1])
+	assert.Equal(t, errNotSubscribed, err)
+	txs, err := s.store.GetTransactions(ctx, addrs[0])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(txs))
+	txs, err = s.store.GetTransactions(ctx, addrs[1])
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(txs))
+
+	// unsubscribed addresses are no longer matched, a running backfill stops.
+	blockInfo.Hash, blockInfo.Transactions[0].Hash = "0xc", "0x2"
+	changed, err := s.applyBlock(ctx, blockInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(changed))
+	_, _, err = s.backfillBlock(ctx, addrs[1], blockInfo)
+	assert.Equal(t, errUnsubscribed, err)
+}
+
+func TestETHService_BulkSubscribe(t *testing.T) {
+	ctx := context.Background()
+	const existing = "0x70997970c51812dc3a010c7d01b50e0d17dc79c8"
+	s := &ETHService{subAddrs: map[string]bool{}, store: storage.NewMemoryStorage(""), bulkSubscribeLimit: 5}
+	assert.Nil(t, s.Subscribe(ctx, existing))
+	sub, err := s.GetSubscription(ctx, existing)
+	assert.Nil(t, err)
+
+	s.recentBlockNumer = 100
+	result, err := s.BulkSubscribe(ctx, []*model.ETHSubscribeRequest{
+		{Address: " 0xae2Fc483527B8EF99EB5D9B44875F005ba1FaE13", Label: "deposit", Owner: "acme"},
+		{Address: "0xae2fc483527b8ef99eb5d9b44875f005ba1fae1"},
+		{Address: "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"},
+		{Address: existing, Owner: "acme"},
+		{Address: "0x5fbdb2315678afecb367f032d93f642f64180aag"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Subscribed)
+	assert.Equal(t, 3, result.Failed)
+	for i, want := range []string{"", util.ErrInvalidAddress.Error(), "duplicate address", "", util.ErrInvalidAddress.Error()} {
+		assert.Equal(t, want, result.Results[i].Error, i)
+		assert.Equal(t, len(want) == 0, result.Results[i].OK, i)
+	}
+	assert.Equal(t, model.Address("0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"), result.Results[0].Address)
+	assert.True(t, s.subAddrs["0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"])
+
+	added, err := s.GetSubscription(ctx, "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(101), added.StartBlock)
+	assert.Equal(t, "deposit", added.Label)
+	assert.Equal(t, "acme", added.Owner)
+	// an existing subscription keeps its start block.
+	updated, err := s.GetSubscription(ctx, existing)
+	assert.Nil(t, err)
+	assert.Equal(t, sub.StartBlock, updated.StartBlock)
+	assert.Equal(t, "acme", updated.Owner)
+
+	_, err = s.BulkSubscribe(ctx, make([]*model.ETHSubscribeRequest, 6))
+	assert.NotNil(t, err)
+	_, err = s.BulkSubscribe(ctx, nil)
+	assert.NotNil(t, err)
+}
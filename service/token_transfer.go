@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// tokenEventTopics first topics of the event logs fetched with every block.
+var tokenEventTopics = []string{model.TOPIC_TRANSFER, model.TOPIC_TRANSFER_SINGLE, model.TOPIC_TRANSFER_BATCH}
+
+// maxBatchTransfers cap the token ids decoded from one TransferBatch, the array length comes from untrusted data.
+const maxBatchTransfers = 1024
+
+// decodeTokenTransfers decode the token transfers of an event log, nil if it is not one.
+func decodeTokenTransfers(l *model.ETHLog) []*model.ETHTokenTransfer {
+	if len(l.Topics) == 0 {
+		return nil
+	}
+	switch {
+	case l.Topics[0] == model.TOPIC_TRANSFER && len(l.Topics) == 3:
+		// ERC-20 Transfer: from and to indexed, value in data.
+		value, ok := decodeWord(l.Data, 0)
+		if !ok {
+			return nil
+		}
+		transfer := newTokenTransfer(l, model.TOKEN_STANDARD_ERC20, topicAddress(l.Topics[1]), topicAddress(l.Topics[2]), value)
+		return []*model.ETHTokenTransfer{transfer}
+	case l.Topics[0] == model.TOPIC_TRANSFER && len(l.Topics) == 4:
+		// ERC-721 Transfer: same signature, the token id is indexed too.
+		tokenID, ok := new(big.Int).SetString(strings.TrimPrefix(l.Topics[3], "0x"), 16)
+		if !ok {
+			return nil
+		}
+		transfer := newTokenTransfer(l, model.TOKEN_STANDARD_ERC721, topicAddress(l.Topics[1]), topicAddress(l.Topics[2]), big.NewInt(1))
+		transfer.TokenID = model.NewBig(tokenID)
+		return []*model.ETHTokenTransfer{transfer}
+	case l.Topics[0] == model.TOPIC_TRANSFER_SINGLE && len(l.Topics) == 4:
+		// ERC-1155 TransferSingle: operator, from and to indexed, id and value in data.
+		tokenID, ok1 := decodeWord(l.Data, 0)
+		value, ok2 := decodeWord(l.Data, 1)
+		if !ok1 || !ok2 {
+			return nil
+		}
+		transfer := newTokenTransfer(l, model.TOKEN_STANDARD_ERC1155, topicAddress(l.Topics[2]), topicAddress(l.Topics[3]), value)
+		transfer.Operator = topicAddress(l.Topics[1])
+		transfer.TokenID = model.NewBig(tokenID)
+		return []*model.ETHTokenTransfer{transfer}
+	case l.Topics[0] == model.TOPIC_TRANSFER_BATCH && len(l.Topics) == 4:
+		// ERC-1155 TransferBatch: ids and values are dynamic arrays in data.
+		ids, ok1 := decodeWordArray(l.Data, 0)
+		values, ok2 := decodeWordArray(l.Data, 1)
+		if !ok1 || !ok2 || len(ids) != len(values) {
+			return nil
+		}
+		transfers := make([]*model.ETHTokenTransfer, len(ids))
+		for i := range ids {
+			transfers[i] = newTokenTransfer(l, model.TOKEN_STANDARD_ERC1155, topicAddress(l.Topics[2]), topicAddress(l.Topics[3]), values[i])
+			transfers[i].Operator = topicAddress(l.Topics[1])
+			transfers[i].TokenID = model.NewBig(ids[i])
+			transfers[i].BatchIndex = i
+		}
+		return transfers
+	default:
+		return nil
+	}
+}
+
+// newTokenTransfer token transfer of log l.
+func newTokenTransfer(l *model.ETHLog, standard string, from, to model.Address, value *big.Int) *model.ETHTokenTransfer {
+	return &model.ETHTokenTransfer{
+		Standard:         standard,
+		Token:            l.Address,
+		From:             from,
+		To:               to,
+		Value:            model.NewBig(value),
+		TransactionHash:  l.TransactionHash,
+		TransactionIndex: l.TransactionIndex,
+		BlockNumber:      l.BlockNumber,
+		BlockHash:        l.BlockHash,
+		LogIndex:         l.LogIndex,
+	}
+}
+
+// isNFT report whether transfer moves a non-fungible or semi-fungible token.
+func isNFT(transfer *model.ETHTokenTransfer) bool {
+	return transfer.Standard == model.TOKEN_STANDARD_ERC721 || transfer.Standard == model.TOKEN_STANDARD_ERC1155
+}
+
+// topicAddress address stored in an indexed topic, the last 20 of 32 bytes.
+func topicAddress(topic string) model.Address {
+	topic = strings.ToLower(strings.TrimPrefix(topic, "0x"))
+	if len(topic) < 40 {
+		return ""
+	}
+	return model.Address("0x" + topic[len(topic)-40:])
+}
+
+// decodeWord return the i-th 32 bytes word of ABI encoded data as an unsigned integer.
+func decodeWord(data string, i int) (*big.Int, bool) {
+	data = strings.TrimPrefix(data, "0x")
+	if i < 0 || i >= len(data)/64 {
+		return nil, false
+	}
+	return new(big.Int).SetString(data[i*64:(i+1)*64], 16)
+}
+
+// decodeWordArray return the uint256[] whose offset is the i-th word of ABI encoded data.
+// Offset and length come from untrusted data, both are bounded by the word count before use.
+func decodeWordArray(data string, i int) ([]*big.Int, bool) {
+	words := int64(len(strings.TrimPrefix(data, "0x")) / 64)
+	offset, ok := decodeWord(data, i)
+	if !ok || !offset.IsInt64() || offset.Int64()%32 != 0 || offset.Int64()/32 >= words {
+		return nil, false
+	}
+	start := offset.Int64() / 32
+	length, ok := decodeWord(data, int(start))
+	if !ok || !length.IsInt64() || length.Int64() > maxBatchTransfers || start+1+length.Int64() > words {
+		return nil, false
+	}
+	array := make([]*big.Int, length.Int64())
+	for j := range array {
+		if array[j], ok = decodeWord(data, int(start)+1+j); !ok {
+			return nil, false
+		}
+	}
+	return array, true
+}
+
+// tokenTransferBatch group token transfers of blockInfo by subscribed sender and recipient.
+func tokenTransferBatch(blockInfo *model.ETHBlockInfo, subscribed func(addr string) bool) map[string][]*model.ETHTokenTransfer {
+	batch := map[string][]*model.ETHTokenTransfer{}
+	for _, l := range blockInfo.Logs {
+		for _, transfer := range decodeTokenTransfers(l) {
+			from, to := string(transfer.From), string(transfer.To)
+			if subscribed(from) {
+				// outbound transfer.
+				batch[from] = append(batch[from], transfer)
+			}
+			if subscribed(to) && to != from {
+				// inbound transfer.
+				batch[to] = append(batch[to], transfer)
+			}
+		}
+	}
+	return batch
+}
+
+// GetTokenTransfers list fungible token transfers from or to address, of one token contract if token is not empty.
+func (s *ETHService) GetTokenTransfers(ctx context.Context, address, token string) ([]*model.ETHTokenTransfer, error) {
+	return s.listTokenTransfers(ctx, address, token, false)
+}
+
+// GetNFTTransfers list ERC-721 and ERC-1155 transfers from or to address, of one token contract if token is not empty.
+func (s *ETHService) GetNFTTransfers(ctx context.Context, address, token string) ([]*model.ETHTokenTransfer, error) {
+	return s.listTokenTransfers(ctx, address, token, true)
+}
+
+// listTokenTransfers list stored transfers of address, either NFT or fungible ones.
+func (s *ETHService) listTokenTransfers(ctx context.Context, address, token string, nft bool) ([]*model.ETHTokenTransfer, error) {
+	transfers, err := s.store.GetTokenTransfers(ctx, address)
+	if err != nil {
+		log.Println(ctx, "[listTokenTransfers]: Error GetTokenTransfers, err: ", err)
+		return nil, err
+	}
+	filtered := make([]*model.ETHTokenTransfer, 0)
+	for _, transfer := range transfers {
+		if isNFT(transfer) == nft && (len(token) == 0 || string(transfer.Token) == token) {
+			filtered = append(filtered, transfer)
+		}
+	}
+	return filtered, nil
+}
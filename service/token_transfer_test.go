@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/storage"
+	"github.com/tj/assert"
+)
+
+const (
+	testSender    = "0x00000000000000000000000052908400098527886e0f7030069857d2e4169ee7"
+	testRecipient = "0x000000000000000000000000ae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	testUSDT      = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+)
+
+func TestDecodeTokenTransfers(t *testing.T) {
+	l := &model.ETHLog{
+		Address:  testUSDT,
+		Topics:   []string{model.TOPIC_TRANSFER, testSender, testRecipient},
+		Data:     "0x00000000000000000000000000000000000000000000000000000000000f4240",
+		LogIndex: 0x3,
+	}
+	transfers := decodeTokenTransfers(l)
+	assert.Equal(t, 1, len(transfers))
+	assert.Equal(t, model.Address("0xdac17f958d2ee523a2206206994597c13d831ec7"), transfers[0].Token)
+	assert.Equal(t, model.Address("0x52908400098527886e0f7030069857d2e4169ee7"), transfers[0].From)
+	assert.Equal(t, model.Address("0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"), transfers[0].To)
+	assert.Equal(t, "0xf4240", transfers[0].Value.String())
+	assert.Equal(t, model.Uint64(0x3), transfers[0].LogIndex)
+
+	// other events and malformed data are ignored.
+	assert.Nil(t, decodeTokenTransfers(&model.ETHLog{Topics: []string{"0x1234", testSender, testRecipient}}))
+	assert.Nil(t, decodeTokenTransfers(&model.ETHLog{Topics: []string{model.TOPIC_TRANSFER, testSender, testRecipient}, Data: "0x"}))
+}
+
+func TestETHService_ApplyTokenTransfers(t *testing.T) {
+	ctx := context.Background()
+	addr := "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	s := &ETHService{
+		subAddrs: map[string]bool{addr: true},
+		store:    storage.NewMemoryStorage(""),
+		window:   newBlockWindow(8),
+		reorgs:   &reorgLog{},
+	}
+	// an incoming transfer, the wallet is neither sender nor recipient of the transaction.
+	blockInfo := &model.ETHBlockInfo{
+		Hash:         "0xb",
+		Transactions: []*model.ETHTransaction{{Hash: "0x2", BlockHash: "0xb", BlockNumber: 0xb, To: testUSDT}},
+		Logs: []*model.ETHLog{{
+			Address:         testUSDT,
+			Topics:          []string{model.TOPIC_TRANSFER, testSender, testRecipient},
+			Data:            "0x0000000000000000000000000000000000000000000000000000000000000001",
+			BlockHash:       "0xb",
+			BlockNumber:     0xb,
+			TransactionHash: "0x2",
+			LogIndex:        0x0,
+		}},
+	}
+	addrs, err := s.applyBlock(ctx, blockInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{addr}, addrs)
+	s.window.Push(&windowBlock{number: 11, hash: string(blockInfo.Hash), addrs: addrs})
+
+	transfers, err := s.GetTokenTransfers(ctx, addr, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(transfers))
+	nfts, err := s.GetNFTTransfers(ctx, addr, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(nfts))
+	transfers, err = s.GetTokenTransfers(ctx, addr, "0x0000000000000000000000000000000000000001")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(transfers))
+	txs, err := s.store.GetTransactions(ctx, addr)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(txs))
+
+	// rolled back with its block.
+	event := newReorgEvent(12)
+	_, err = s.rollback(ctx, event)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0x2"}, event.RemovedTransactions)
+	transfers, err = s.GetTokenTransfers(ctx, addr, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(transfers))
+}
+
+func TestDecodeNFTTransfers(t *testing.T) {
+	word := func(n string) string {
+		return fmt.Sprintf("%064s", n)
+	}
+	operator := "0x0000000000000000000000001e0049783f008a0085193e00003d00cd54003c71"
+
+	// ERC-721, token id indexed.
+	transfers := decodeTokenTransfers(&model.ETHLog{
+		Address: testUSDT,
+		Topics:  []string{model.TOPIC_TRANSFER, testSender, testRecipient, "0x" + word("2a")},
+		Data:    "0x",
+	})
+	assert.Equal(t, 1, len(transfers))
+	assert.Equal(t, model.TOKEN_STANDARD_ERC721, transfers[0].Standard)
+	assert.Equal(t, "0x2a", transfers[0].TokenID.String())
+	assert.Equal(t, "0x1", transfers[0].Value.String())
+	assert.True(t, isNFT(transfers[0]))
+
+	// ERC-1155 single.
+	transfers = decodeTokenTransfers(&model.ETHLog{
+		Topics: []string{model.TOPIC_TRANSFER_SINGLE, operator, testSender, testRecipient},
+		Data:   "0x" + word("7") + word("64"),
+	})
+	assert.Equal(t, 1, len(transfers))
+	assert.Equal(t, model.TOKEN_STANDARD_ERC1155, transfers[0].Standard)
+	assert.Equal(t, model.Address("0x1e0049783f008a0085193e00003d00cd54003c71"), transfers[0].Operator)
+	assert.Equal(t, model.Address("0x52908400098527886e0f7030069857d2e4169ee7"), transfers[0].From)
+	assert.Equal(t, "0x7", transfers[0].TokenID.String())
+	assert.Equal(t, "0x64", transfers[0].Value.String())
+
+	// ERC-1155 batch: ids [1, 2] and values [10, 20].
+	transfers = decodeTokenTransfers(&model.ETHLog{
+		Topics: []string{model.TOPIC_TRANSFER_BATCH, operator, testSender, testRecipient},
+		Data:   "0x" + word("40") + word("a0") + word("2") + word("1") + word("2") + word("2") + word("a") + word("14"),
+	})
+	assert.Equal(t, 2, len(transfers))
+	assert.Equal(t, "0x2", transfers[1].TokenID.String())
+	assert.Equal(t, "0x14", transfers[1].Value.String())
+	assert.Equal(t, 1, transfers[1].BatchIndex)
+
+	// mismatched array lengths.
+	assert.Nil(t, decodeTokenTransfers(&model.ETHLog{
+		Topics: []string{model.TOPIC_TRANSFER_BATCH, operator, testSender, testRecipient},
+		Data:   "0x" + word("40") + word("a0") + word("2") + word("1") + word("2") + word("1") + word("a"),
+	}))
+	// an offset near 2^62 and an oversized length are rejected rather than overflowing the slice bounds.
+	assert.Nil(t, decodeTokenTransfers(&model.ETHLog{
+		Topics: []string{model.TOPIC_TRANSFER_BATCH, operator, testSender, testRecipient},
+		Data:   "0x" + word("4000000000000000") + word("a0") + word("2") + word("1") + word("2") + word("2") + word("a") + word("14"),
+	}))
+	assert.Nil(t, decodeTokenTransfers(&model.ETHLog{
+		Topics: []string{model.TOPIC_TRANSFER_BATCH, operator, testSender, testRecipient},
+		Data:   "0x" + word("40") + word("a0") + word("3ff") + word("1") + word("2") + word("2") + word("a") + word("14"),
+	}))
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/sugarshop/token-gateway/remote"
+	"github.com/sugarshop/token-gateway/util"
+)
+
+// ingest transports.
+const (
+	TRANSPORT_POLL = "poll" // query eth_blockNumber every second.
+	TRANSPORT_WS   = "ws"   // eth_subscribe("newHeads") over WebSocket, polling while the socket is down.
+)
+
+// pollInterval how often the head is polled.
+const pollInterval = 1 * time.Second
+
+// headsSubscriber subscribe to new chain heads, remote.ETHWSService in production.
+type headsSubscriber interface {
+	SubscribeNewHeads(ctx context.Context) (*remote.HeadsSubscription, error)
+}
+
+// run drive ingestion forever with transport.
+func (s *ETHService) run(ctx context.Context, transport string) {
+	if transport != TRANSPORT_WS {
+		s.poll(ctx, nil)
+		return
+	}
+	reconnect := util.EnvDuration("WS_RECONNECT_INTERVAL", 10*time.Second)
+	subscriber := remote.ETHWSServiceInstance()
+	for {
+		s.followHeads(ctx, subscriber)
+		// the socket is down, poll until the next reconnect attempt.
+		s.poll(ctx, time.After(reconnect))
+	}
+}
+
+// poll load new blocks every pollInterval until stop fires, forever if stop is nil.
+func (s *ETHService) poll(ctx context.Context, stop <-chan time.Time) {
+	s.setTransport(TRANSPORT_POLL)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		// query eth block number per second.
+		// if new block number appear, getBlockByNumber.
+		// parse tx into inbount/outbound.
+		select {
+		case <-ticker.C:
+			if err := s.load(ctx); err != nil {
+				log.Println(ctx, "[poll]: load err: ", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// followHeads load new blocks on every newHeads notification until the subscription drops.
+func (s *ETHService) followHeads(ctx context.Context, subscriber headsSubscriber) {
+	sub, err := subscriber.SubscribeNewHeads(ctx)
+	if err != nil {
+		log.Println(ctx, "[followHeads]: Error SubscribeNewHeads, fall back to polling, err: ", err)
+		return
+	}
+	defer sub.Close()
+	s.setTransport(TRANSPORT_WS)
+	log.Println(ctx, "[followHeads]: following newHeads")
+	// catch up blocks produced while the socket was down.
+	if err := s.load(ctx); err != nil {
+		log.Println(ctx, "[followHeads]: load err: ", err)
+	}
+	for {
+		select {
+		case header, ok := <-sub.Heads():
+			if !ok {
+				return
+			}
+			num := latestHead(header, sub.Heads())
+			if num < 0 {
+				continue
+			}
+			if err := s.loadTo(ctx, num); err != nil {
+				log.Println(ctx, "[followHeads]: loadTo err: ", err)
+			}
+		case err := <-sub.Err():
+			log.Println(ctx, "[followHeads]: subscription dropped, fall back to polling, err: ", err)
+			return
+		}
+	}
+}
+
+// latestHead return the highest head number among header and heads already queued,
+// ingestion fetches every block up to it anyway. -1 if none parses.
+func latestHead(header *model.ETHBlockHeader, heads <-chan *model.ETHBlockHeader) int64 {
+	latest := int64(-1)
+	for {
+		if num, err := util.ParseHexInt64(header.Number); err == nil && num > latest {
+			latest = num
+		}
+		select {
+		case next, ok := <-heads:
+			if !ok {
+				return latest
+			}
+			header = next
+		default:
+			return latest
+		}
+	}
+}
+
+// setTransport record the transport currently driving ingestion.
+func (s *ETHService) setTransport(transport string) {
+	s.transport.Store(transport)
+}
+
+// currentTransport return the transport currently driving ingestion.
+func (s *ETHService) currentTransport() string {
+	transport, _ := s.transport.Load().(string)
+	return transport
+}
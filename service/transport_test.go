@@ -0,0 +1,20 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+func TestLatestHead(t *testing.T) {
+	heads := make(chan *model.ETHBlockHeader, 4)
+	heads <- &model.ETHBlockHeader{Number: "0x12"}
+	heads <- &model.ETHBlockHeader{Number: "bad"}
+	heads <- &model.ETHBlockHeader{Number: "0x11"}
+	assert.Equal(t, int64(0x12), latestHead(&model.ETHBlockHeader{Number: "0x10"}, heads))
+	assert.Equal(t, 0, len(heads))
+
+	close(heads)
+	assert.Equal(t, int64(-1), latestHead(&model.ETHBlockHeader{Number: "bad"}, heads))
+}
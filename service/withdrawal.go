@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math/big"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// weiPerGwei withdrawal amounts are denominated in gwei, everything else in wei.
+var weiPerGwei = big.NewInt(1e9)
+
+// gweiToWei convert an amount of gwei to wei.
+func gweiToWei(gwei model.Uint64) *model.Wei {
+	return model.NewWei(new(big.Int).Mul(new(big.Int).SetUint64(uint64(gwei)), weiPerGwei))
+}
+
+// newWithdrawal withdrawal of blockInfo with its amount converted to wei.
+func newWithdrawal(blockInfo *model.ETHBlockInfo, withdraw *model.ETHWithdraw) *model.ETHWithdrawal {
+	return &model.ETHWithdrawal{
+		Index:          withdraw.Index,
+		ValidatorIndex: withdraw.ValidatorIndex,
+		Address:        withdraw.Address,
+		Amount:         gweiToWei(withdraw.Amount),
+		AmountGwei:     withdraw.Amount,
+		BlockNumber:    blockInfo.Number,
+		BlockHash:      blockInfo.Hash,
+		Timestamp:      blockInfo.Timestamp,
+	}
+}
+
+// withdrawalBatch group withdrawals of blockInfo by subscribed recipient, withdrawals are always inbound.
+func withdrawalBatch(blockInfo *model.ETHBlockInfo, subscribed func(addr string) bool) map[string][]*model.ETHWithdrawal {
+	batch := map[string][]*model.ETHWithdrawal{}
+	for _, withdraw := range blockInfo.Withdrawals {
+		addr := string(withdraw.Address)
+		if subscribed(addr) {
+			batch[addr] = append(batch[addr], newWithdrawal(blockInfo, withdraw))
+		}
+	}
+	return batch
+}
+
+// GetWithdrawals list beacon chain withdrawals credited to address.
+func (s *ETHService) GetWithdrawals(ctx context.Context, address string) ([]*model.ETHWithdrawal, error) {
+	withdrawals, err := s.store.GetWithdrawals(ctx, address)
+	if err != nil {
+		log.Println(ctx, "[GetWithdrawals]: Error GetWithdrawals, err: ", err)
+		return nil, err
+	}
+	return withdrawals, nil
+}
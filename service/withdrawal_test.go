@@ -0,0 +1,39 @@
+package service
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+func TestGweiToWei(t *testing.T) {
+	assert.Equal(t, "0x0", gweiToWei(0).String())
+	// 1 gwei.
+	assert.Equal(t, "0x3b9aca00", gweiToWei(1).String())
+	// 32 ether.
+	assert.Equal(t, "32", gweiToWei(0x773594000).Ether())
+}
+
+func TestWithdrawalBatch(t *testing.T) {
+	addr := "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	blockInfo := &model.ETHBlockInfo{}
+	err := json.Unmarshal([]byte(`{"number":"0x10","hash":"0xa","timestamp":"0x64","withdrawals":[
+		{"index":"0x1","validatorIndex":"0x5","address":"0xAE2Fc483527B8EF99EB5D9B44875F005ba1FaE13","amount":"0x1"},
+		{"index":"0x2","validatorIndex":"0x6","address":"0x70997970c51812dc3a010c7d01b50e0d17dc79c8","amount":"0x2"}]}`), blockInfo)
+	assert.Nil(t, err)
+	batch := withdrawalBatch(blockInfo, func(a string) bool { return a == addr })
+	assert.Equal(t, 1, len(batch))
+	assert.Equal(t, []*model.ETHWithdrawal{{
+		Index:          0x1,
+		ValidatorIndex: 0x5,
+		Address:        model.Address(addr),
+		Amount:         model.NewWei(big.NewInt(1e9)),
+		AmountGwei:     0x1,
+		BlockNumber:    0x10,
+		BlockHash:      "0xa",
+		Timestamp:      0x64,
+	}}, batch[addr])
+}
@@ -0,0 +1,497 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sugarshop/token-gateway/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// bolt bucket names.
+var (
+	bucketSubscriptions     = []byte("subscriptions")      // address -> subscription json.
+	bucketTransactions      = []byte("transactions")       // address bucket -> txKey -> transaction json.
+	bucketTokenTransfers    = []byte("token_transfers")    // address bucket -> transferKey -> token transfer json.
+	bucketInternalTransfers = []byte("internal_transfers") // address bucket -> internalKey -> internal transfer json.
+	bucketWithdrawals       = []byte("withdrawals")        // address bucket -> withdrawalKey -> withdrawal json.
+	bucketBackfillJobs      = []byte("backfill_jobs")      // job id -> backfill job json.
+	bucketMeta              = []byte("meta")               // cursor etc.
+	keyCursor               = []byte("cursor")
+)
+
+// BoltStorage embedded on-disk storage backed by BoltDB, survive restarts.
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+// per address histories, each in its own bucket keyed like the memory backend.
+var (
+	boltTransactions      = &boltRecords[model.ETHTransaction]{name: bucketTransactions, key: txKey, block: txBlock}
+	boltTokenTransfers    = &boltRecords[model.ETHTokenTransfer]{name: bucketTokenTransfers, key: transferKey, block: transferBlock}
+	boltInternalTransfers = &boltRecords[model.ETHInternalTransfer]{name: bucketInternalTransfers, key: internalKey, block: internalBlock}
+	boltWithdrawals       = &boltRecords[model.ETHWithdrawal]{name: bucketWithdrawals, key: withdrawalKey, block: withdrawalBlock}
+)
+
+// NewBoltStorage open or create the database file at path.
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Println("[NewBoltStorage]: Error MkdirAll, err: ", err)
+		return nil, err
+	}
+	// timeout avoid hanging forever when another process still holds the file lock.
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		log.Println("[NewBoltStorage]: Error Open, err: ", err)
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketSubscriptions, bucketTransactions, bucketTokenTransfers, bucketInternalTransfers, bucketWithdrawals, bucketBackfillJobs, bucketMeta} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("[NewBoltStorage]: Error CreateBucketIfNotExists, err: ", err)
+		db.Close()
+		return nil, err
+	}
+	return &BoltStorage{db: db}, nil
+}
+
+// PutSubscription create or replace a subscription.
+func (b *BoltStorage) PutSubscription(ctx context.Context, sub *model.ETHSubscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.PutSubscription]: Error Marshal, err: ", err)
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSubscriptions).Put([]byte(sub.Address), data)
+	})
+}
+
+// PutSubscriptions create or replace subscriptions in one write transaction.
+func (b *BoltStorage) PutSubscriptions(ctx context.Context, subs []*model.ETHSubscription) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSubscriptions)
+		for _, sub := range subs {
+			data, err := json.Marshal(sub)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(sub.Address), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.PutSubscriptions]: Error Update, err: ", err)
+		return err
+	}
+	return nil
+}
+
+// ListSubscriptions return all subscriptions ordered by address.
+func (b *BoltStorage) ListSubscriptions(ctx context.Context) ([]*model.ETHSubscription, error) {
+	subs := make([]*model.ETHSubscription, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSubscriptions).ForEach(func(k, v []byte) error {
+			sub := &model.ETHSubscription{}
+			if err := json.Unmarshal(v, sub); err != nil {
+				return err
+			}
+			subs = append(subs, sub)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.ListSubscriptions]: Error View, err: ", err)
+		return nil, err
+	}
+	return subs, nil
+}
+
+// QuerySubscriptions return a page of subscriptions ordered by address after cursor, and the cursor of the next page.
+func (b *BoltStorage) QuerySubscriptions(ctx context.Context, owner, cursor string, limit int) ([]*model.ETHSubscription, string, error) {
+	subs := make([]*model.ETHSubscription, 0)
+	next := ""
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketSubscriptions).Cursor()
+		for k, v := c.Seek([]byte(cursor)); k != nil; k, v = c.Next() {
+			if string(k) == cursor {
+				continue
+			}
+			sub := &model.ETHSubscription{}
+			if err := json.Unmarshal(v, sub); err != nil {
+				return err
+			}
+			if len(owner) > 0 && sub.Owner != owner {
+				continue
+			}
+			if len(subs) == limit {
+				next = string(subs[limit-1].Address)
+				return nil
+			}
+			subs = append(subs, sub)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.QuerySubscriptions]: Error View, err: ", err)
+		return nil, "", err
+	}
+	return subs, next, nil
+}
+
+// GetSubscription return the subscription of address.
+func (b *BoltStorage) GetSubscription(ctx context.Context, address string) (*model.ETHSubscription, bool, error) {
+	var data []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data = append(data, tx.Bucket(bucketSubscriptions).Get([]byte(address))...)
+		return nil
+	})
+	if err != nil || len(data) == 0 {
+		return nil, false, err
+	}
+	sub := &model.ETHSubscription{}
+	if err := json.Unmarshal(data, sub); err != nil {
+		log.Println(ctx, "[BoltStorage.GetSubscription]: Error Unmarshal, err: ", err)
+		return nil, false, err
+	}
+	return sub, true, nil
+}
+
+// DeleteSubscription remove the subscription of address, and its history if purge, in one write transaction.
+func (b *BoltStorage) DeleteSubscription(ctx context.Context, address string, purge bool) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketSubscriptions).Delete([]byte(address)); err != nil {
+			return err
+		}
+		if !purge {
+			return nil
+		}
+		for _, name := range [][]byte{bucketTransactions, bucketTokenTransfers, bucketInternalTransfers, bucketWithdrawals} {
+			err := tx.Bucket(name).DeleteBucket([]byte(address))
+			if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.DeleteSubscription]: Error Update, err: ", err)
+		return err
+	}
+	return nil
+}
+
+// AppendBlock store the records of one block in one write transaction.
+func (b *BoltStorage) AppendBlock(ctx context.Context, batch *BlockBatch) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if err := boltTransactions.put(tx, batch.Transactions); err != nil {
+			return err
+		}
+		if err := boltTokenTransfers.put(tx, batch.TokenTransfers); err != nil {
+			return err
+		}
+		if err := boltInternalTransfers.put(tx, batch.InternalTransfers); err != nil {
+			return err
+		}
+		return boltWithdrawals.put(tx, batch.Withdrawals)
+	})
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.AppendBlock]: Error Update, err: ", err)
+		return err
+	}
+	return nil
+}
+
+// GetTransactions return transactions of address ordered by block number and transaction index.
+func (b *BoltStorage) GetTransactions(ctx context.Context, address string) ([]*model.ETHTransaction, error) {
+	list, err := boltTransactions.get(b.db, address)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.GetTransactions]: Error View, err: ", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// QueryTransactions return a page of transactions of address matching query, and the cursor of the next page.
+func (b *BoltStorage) QueryTransactions(ctx context.Context, address string, query *model.ETHTxQuery) ([]*model.ETHTransaction, string, error) {
+	after, err := decodeTxCursor(query.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	page := newTxPage(address, query)
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketTransactions).Bucket([]byte(address))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		var k, v []byte
+		next := c.Next
+		switch {
+		case query.Order == model.ORDER_DESC:
+			next = c.Prev
+			if after == nil {
+				k, v = c.Last()
+			} else if k, _ = c.Seek(after); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		case after == nil:
+			k, v = c.First()
+		default:
+			if k, v = c.Seek(after); bytes.Equal(k, after) {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = next() {
+			t := &model.ETHTransaction{}
+			if err := json.Unmarshal(v, t); err != nil {
+				return err
+			}
+			if !page.add(t) {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.QueryTransactions]: Error View, err: ", err)
+		return nil, "", err
+	}
+	return page.list, page.next, nil
+}
+
+// RemoveBlockTransactions remove transactions of address included in block hash.
+func (b *BoltStorage) RemoveBlockTransactions(ctx context.Context, address string, number int64, blockHash string) ([]string, error) {
+	removed, err := boltTransactions.removeBlock(b.db, address, number, blockHash)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.RemoveBlockTransactions]: Error Update, err: ", err)
+		return nil, err
+	}
+	return removed, nil
+}
+
+// GetTokenTransfers return token transfers of address ordered by block number and log index.
+func (b *BoltStorage) GetTokenTransfers(ctx context.Context, address string) ([]*model.ETHTokenTransfer, error) {
+	list, err := boltTokenTransfers.get(b.db, address)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.GetTokenTransfers]: Error View, err: ", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// RemoveBlockTokenTransfers remove token transfers of address included in block hash.
+func (b *BoltStorage) RemoveBlockTokenTransfers(ctx context.Context, address string, number int64, blockHash string) ([]string, error) {
+	removed, err := boltTokenTransfers.removeBlock(b.db, address, number, blockHash)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.RemoveBlockTokenTransfers]: Error Update, err: ", err)
+		return nil, err
+	}
+	return removed, nil
+}
+
+// GetInternalTransfers return internal transfers of address ordered by block number, transaction index and trace address.
+func (b *BoltStorage) GetInternalTransfers(ctx context.Context, address string) ([]*model.ETHInternalTransfer, error) {
+	list, err := boltInternalTransfers.get(b.db, address)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.GetInternalTransfers]: Error View, err: ", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// RemoveBlockInternalTransfers remove internal transfers of address included in block hash.
+func (b *BoltStorage) RemoveBlockInternalTransfers(ctx context.Context, address string, number int64, blockHash string) ([]string, error) {
+	removed, err := boltInternalTransfers.removeBlock(b.db, address, number, blockHash)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.RemoveBlockInternalTransfers]: Error Update, err: ", err)
+		return nil, err
+	}
+	return removed, nil
+}
+
+// GetWithdrawals return withdrawals of address ordered by block number and withdrawal index.
+func (b *BoltStorage) GetWithdrawals(ctx context.Context, address string) ([]*model.ETHWithdrawal, error) {
+	list, err := boltWithdrawals.get(b.db, address)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.GetWithdrawals]: Error View, err: ", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// RemoveBlockWithdrawals remove withdrawals of address included in block hash.
+func (b *BoltStorage) RemoveBlockWithdrawals(ctx context.Context, address string, number int64, blockHash string) ([]string, error) {
+	removed, err := boltWithdrawals.removeBlock(b.db, address, number, blockHash)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.RemoveBlockWithdrawals]: Error Update, err: ", err)
+		return nil, err
+	}
+	return removed, nil
+}
+
+// PutBackfillJob create or replace a backfill job.
+func (b *BoltStorage) PutBackfillJob(ctx context.Context, job *model.ETHBackfillJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.PutBackfillJob]: Error Marshal, err: ", err)
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBackfillJobs).Put([]byte(job.ID), data)
+	})
+}
+
+// ListBackfillJobs return all backfill jobs ordered by id.
+func (b *BoltStorage) ListBackfillJobs(ctx context.Context) ([]*model.ETHBackfillJob, error) {
+	jobs := make([]*model.ETHBackfillJob, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBackfillJobs).ForEach(func(k, v []byte) error {
+			job := &model.ETHBackfillJob{}
+			if err := json.Unmarshal(v, job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.ListBackfillJobs]: Error View, err: ", err)
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// LoadCursor return the last fully processed block number.
+func (b *BoltStorage) LoadCursor(ctx context.Context) (int64, bool, error) {
+	var data []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data = append(data, tx.Bucket(bucketMeta).Get(keyCursor)...)
+		return nil
+	})
+	if err != nil || len(data) == 0 {
+		return 0, false, err
+	}
+	num, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		log.Println(ctx, "[BoltStorage.LoadCursor]: Error ParseInt, err: ", err)
+		return 0, false, err
+	}
+	return num, true, nil
+}
+
+// SaveCursor persist the last fully processed block number.
+func (b *BoltStorage) SaveCursor(ctx context.Context, number int64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put(keyCursor, []byte(strconv.FormatInt(number, 10)))
+	})
+}
+
+// Close close the database file.
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
+
+// boltRecords records of one kind stored as json in a bucket per address under name, keys start with the block number.
+type boltRecords[T any] struct {
+	name  []byte
+	key   func(*T) []byte
+	block func(*T) (blockHash, id string)
+}
+
+// put store records per address in write transaction tx, a record with the same key is replaced.
+func (r *boltRecords[T]) put(tx *bolt.Tx, batch map[string][]*T) error {
+	root := tx.Bucket(r.name)
+	for addr, records := range batch {
+		bucket, err := root.CreateBucketIfNotExists([]byte(addr))
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(r.key(record), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// get return records of address in key order.
+func (r *boltRecords[T]) get(db *bolt.DB, address string) ([]*T, error) {
+	list := make([]*T, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(r.name).Bucket([]byte(address))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			record := new(T)
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+			list = append(list, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// removeBlock remove records of address included in block hash at number, return their ids.
+func (r *boltRecords[T]) removeBlock(db *bolt.DB, address string, number int64, blockHash string) ([]string, error) {
+	removed := make([]string, 0)
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(r.name).Bucket([]byte(address))
+		if bucket == nil {
+			return nil
+		}
+		prefix := make([]byte, 8)
+		binary.BigEndian.PutUint64(prefix, uint64(number))
+		var keys [][]byte
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			record := new(T)
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+			if hash, id := r.block(record); hash == blockHash {
+				keys = append(keys, append([]byte{}, k...))
+				removed = append(removed, id)
+			}
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
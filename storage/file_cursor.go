@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// fileCursor persist the last fully processed block number in a plain file,
+// used by the memory storage so that a restart still resumes ingestion where it stopped.
+type fileCursor struct {
+	path string
+}
+
+// newFileCursor return a cursor stored at path, empty path disable persistence.
+func newFileCursor(path string) *fileCursor {
+	return &fileCursor{path: path}
+}
+
+// Load return the persisted block number, ok is false if no cursor was saved yet.
+func (c *fileCursor) Load(ctx context.Context) (int64, bool, error) {
+	if len(c.path) == 0 {
+		return 0, false, nil
+	}
+	data, err := ioutil.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		log.Println(ctx, "[fileCursor.Load]: Error ReadFile, err: ", err)
+		return 0, false, err
+	}
+	num, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		log.Println(ctx, "[fileCursor.Load]: Error ParseInt, err: ", err)
+		return 0, false, err
+	}
+	return num, true, nil
+}
+
+// Save persist block number, write to a temp file then rename it to avoid a torn cursor.
+func (c *fileCursor) Save(ctx context.Context, number int64) error {
+	if len(c.path) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		log.Println(ctx, "[fileCursor.Save]: Error MkdirAll, err: ", err)
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.FormatInt(number, 10)), 0644); err != nil {
+		log.Println(ctx, "[fileCursor.Save]: Error WriteFile, err: ", err)
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		log.Println(ctx, "[fileCursor.Save]: Error Rename, err: ", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestFileCursor_SaveLoad(t *testing.T) {
+	ctx := context.Background()
+	cursor := newFileCursor(filepath.Join(t.TempDir(), "data", "cursor"))
+	_, ok, err := cursor.Load(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, false, ok)
+
+	assert.Nil(t, cursor.Save(ctx, 19862630))
+	num, ok, err := cursor.Load(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, int64(19862630), num)
+}
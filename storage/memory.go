@@ -0,0 +1,389 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// MemoryStorage in-process storage, everything but the cursor is lost on restart.
+type MemoryStorage struct {
+	subRWMutex        sync.RWMutex
+	subscriptions     map[string]*model.ETHSubscription
+	subAddresses      []string // subscribed addresses kept sorted, pages seek into it.
+	transactions      *memoryRecords[model.ETHTransaction]
+	tokenTransfers    *memoryRecords[model.ETHTokenTransfer]
+	internalTransfers *memoryRecords[model.ETHInternalTransfer]
+	withdrawals       *memoryRecords[model.ETHWithdrawal]
+	jobRWMutex        sync.RWMutex
+	backfillJobs      map[string]*model.ETHBackfillJob
+	cursor            *fileCursor
+}
+
+// NewMemoryStorage return memory storage, cursorFile persist the ingest cursor if not empty.
+func NewMemoryStorage(cursorFile string) *MemoryStorage {
+	return &MemoryStorage{
+		subscriptions:     map[string]*model.ETHSubscription{},
+		transactions:      newMemoryRecords(txKey, txBlock),
+		tokenTransfers:    newMemoryRecords(transferKey, transferBlock),
+		internalTransfers: newMemoryRecords(internalKey, internalBlock),
+		withdrawals:       newMemoryRecords(withdrawalKey, withdrawalBlock),
+		backfillJobs:      map[string]*model.ETHBackfillJob{},
+		cursor:            newFileCursor(cursorFile),
+	}
+}
+
+// memoryRecords records of one kind per address, each list kept ordered by key.
+type memoryRecords[T any] struct {
+	rwMutex sync.RWMutex
+	lists   map[string][]*T
+	key     func(*T) []byte
+	block   func(*T) (blockHash, id string)
+}
+
+func newMemoryRecords[T any](key func(*T) []byte, block func(*T) (string, string)) *memoryRecords[T] {
+	return &memoryRecords[T]{lists: map[string][]*T{}, key: key, block: block}
+}
+
+// append store records per address, a record with the same key is replaced.
+func (r *memoryRecords[T]) append(batch map[string][]*T) {
+	r.rwMutex.Lock()
+	defer r.rwMutex.Unlock()
+	for addr, records := range batch {
+		// build a new slice, readers may still hold the old one.
+		list := append([]*T{}, r.lists[addr]...)
+		for _, record := range records {
+			list = r.upsert(list, record)
+		}
+		r.lists[addr] = list
+	}
+}
+
+// upsert insert record into list kept ordered by key, replace the same record if present.
+func (r *memoryRecords[T]) upsert(list []*T, record *T) []*T {
+	key := r.key(record)
+	i := sort.Search(len(list), func(i int) bool {
+		return bytes.Compare(r.key(list[i]), key) >= 0
+	})
+	if i < len(list) && bytes.Equal(r.key(list[i]), key) {
+		list[i] = record
+		return list
+	}
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = record
+	return list
+}
+
+// get return records of address in key order, never nil.
+func (r *memoryRecords[T]) get(address string) []*T {
+	r.rwMutex.RLock()
+	list, ok := r.lists[address]
+	r.rwMutex.RUnlock()
+	if !ok {
+		list = make([]*T, 0)
+	}
+	return list
+}
+
+// removeBlock remove records of address included in block hash, return their ids.
+func (r *memoryRecords[T]) removeBlock(address, blockHash string) []string {
+	r.rwMutex.Lock()
+	defer r.rwMutex.Unlock()
+	list := r.lists[address]
+	kept := make([]*T, 0, len(list))
+	removed := make([]string, 0)
+	for _, record := range list {
+		if hash, id := r.block(record); hash == blockHash {
+			removed = append(removed, id)
+			continue
+		}
+		kept = append(kept, record)
+	}
+	r.lists[address] = kept
+	return removed
+}
+
+// delete remove every record of address.
+func (r *memoryRecords[T]) delete(address string) {
+	r.rwMutex.Lock()
+	delete(r.lists, address)
+	r.rwMutex.Unlock()
+}
+
+// PutSubscription create or replace a subscription.
+func (m *MemoryStorage) PutSubscription(ctx context.Context, sub *model.ETHSubscription) error {
+	m.subRWMutex.Lock()
+	m.putSubscription(sub)
+	m.subRWMutex.Unlock()
+	return nil
+}
+
+// PutSubscriptions create or replace subscriptions in one batch.
+func (m *MemoryStorage) PutSubscriptions(ctx context.Context, subs []*model.ETHSubscription) error {
+	m.subRWMutex.Lock()
+	for _, sub := range subs {
+		m.putSubscription(sub)
+	}
+	m.subRWMutex.Unlock()
+	return nil
+}
+
+// putSubscription store sub and keep subAddresses sorted, the caller holds subRWMutex.
+func (m *MemoryStorage) putSubscription(sub *model.ETHSubscription) {
+	address := string(sub.Address)
+	if _, ok := m.subscriptions[address]; !ok {
+		i := sort.SearchStrings(m.subAddresses, address)
+		m.subAddresses = append(m.subAddresses, "")
+		copy(m.subAddresses[i+1:], m.subAddresses[i:])
+		m.subAddresses[i] = address
+	}
+	m.subscriptions[address] = sub
+}
+
+// ListSubscriptions return all subscriptions ordered by address.
+func (m *MemoryStorage) ListSubscriptions(ctx context.Context) ([]*model.ETHSubscription, error) {
+	m.subRWMutex.RLock()
+	subs := make([]*model.ETHSubscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		subs = append(subs, sub)
+	}
+	m.subRWMutex.RUnlock()
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Address < subs[j].Address
+	})
+	return subs, nil
+}
+
+// QuerySubscriptions return a page of subscriptions ordered by address after cursor, and the cursor of the next page.
+func (m *MemoryStorage) QuerySubscriptions(ctx context.Context, owner, cursor string, limit int) ([]*model.ETHSubscription, string, error) {
+	m.subRWMutex.RLock()
+	defer m.subRWMutex.RUnlock()
+	subs := make([]*model.ETHSubscription, 0)
+	for i := sort.SearchStrings(m.subAddresses, cursor); i < len(m.subAddresses); i++ {
+		sub := m.subscriptions[m.subAddresses[i]]
+		if string(sub.Address) == cursor || (len(owner) > 0 && sub.Owner != owner) {
+			continue
+		}
+		if len(subs) == limit {
+			return subs, string(subs[limit-1].Address), nil
+		}
+		subs = append(subs, sub)
+	}
+	return subs, "", nil
+}
+
+// GetSubscription return the subscription of address.
+func (m *MemoryStorage) GetSubscription(ctx context.Context, address string) (*model.ETHSubscription, bool, error) {
+	m.subRWMutex.RLock()
+	sub, ok := m.subscriptions[address]
+	m.subRWMutex.RUnlock()
+	return sub, ok, nil
+}
+
+// DeleteSubscription remove the subscription of address, and its history if purge.
+func (m *MemoryStorage) DeleteSubscription(ctx context.Context, address string, purge bool) error {
+	m.subRWMutex.Lock()
+	if _, ok := m.subscriptions[address]; ok {
+		delete(m.subscriptions, address)
+		i := sort.SearchStrings(m.subAddresses, address)
+		m.subAddresses = append(m.subAddresses[:i], m.subAddresses[i+1:]...)
+	}
+	m.subRWMutex.Unlock()
+	if !purge {
+		return nil
+	}
+	m.transactions.delete(address)
+	m.tokenTransfers.delete(address)
+	m.internalTransfers.delete(address)
+	m.withdrawals.delete(address)
+	return nil
+}
+
+// AppendBlock store the records of one block, appending in memory never fails part way.
+func (m *MemoryStorage) AppendBlock(ctx context.Context, batch *BlockBatch) error {
+	m.transactions.append(batch.Transactions)
+	m.tokenTransfers.append(batch.TokenTransfers)
+	m.internalTransfers.append(batch.InternalTransfers)
+	m.withdrawals.append(batch.Withdrawals)
+	return nil
+}
+
+// GetTransactions return transactions of address ordered by block number and transaction index.
+func (m *MemoryStorage) GetTransactions(ctx context.Context, address string) ([]*model.ETHTransaction, error) {
+	return m.transactions.get(address), nil
+}
+
+// QueryTransactions return a page of transactions of address matching query, and the cursor of the next page.
+func (m *MemoryStorage) QueryTransactions(ctx context.Context, address string, query *model.ETHTxQuery) ([]*model.ETHTransaction, string, error) {
+	after, err := decodeTxCursor(query.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	txList := m.transactions.get(address)
+	page := newTxPage(address, query)
+	if query.Order == model.ORDER_DESC {
+		i := len(txList)
+		if after != nil {
+			i = sort.Search(len(txList), func(i int) bool {
+				return bytes.Compare(txKey(txList[i]), after) >= 0
+			})
+		}
+		for i--; i >= 0 && page.add(txList[i]); i-- {
+		}
+	} else {
+		i := 0
+		if after != nil {
+			i = sort.Search(len(txList), func(i int) bool {
+				return bytes.Compare(txKey(txList[i]), after) > 0
+			})
+		}
+		for ; i < len(txList) && page.add(txList[i]); i++ {
+		}
+	}
+	return page.list, page.next, nil
+}
+
+// RemoveBlockTransactions remove transactions of address included in block hash.
+func (m *MemoryStorage) RemoveBlockTransactions(ctx context.Context, address string, number int64, blockHash string) ([]string, error) {
+	return m.transactions.removeBlock(address, blockHash), nil
+}
+
+// GetTokenTransfers return token transfers of address ordered by block number and log index.
+func (m *MemoryStorage) GetTokenTransfers(ctx context.Context, address string) ([]*model.ETHTokenTransfer, error) {
+	return m.tokenTransfers.get(address), nil
+}
+
+// RemoveBlockTokenTransfers remove token transfers of address included in block hash.
+func (m *MemoryStorage) RemoveBlockTokenTransfers(ctx context.Context, address string, number int64, blockHash string) ([]string, error) {
+	return m.tokenTransfers.removeBlock(address, blockHash), nil
+}
+
+// GetInternalTransfers return internal transfers of address ordered by block number, transaction index and trace address.
+func (m *MemoryStorage) GetInternalTransfers(ctx context.Context, address string) ([]*model.ETHInternalTransfer, error) {
+	return m.internalTransfers.get(address), nil
+}
+
+// RemoveBlockInternalTransfers remove internal transfers of address included in block hash.
+func (m *MemoryStorage) RemoveBlockInternalTransfers(ctx context.Context, address string, number int64, blockHash string) ([]string, error) {
+	return m.internalTransfers.removeBlock(address, blockHash), nil
+}
+
+// GetWithdrawals return withdrawals of address ordered by block number and withdrawal index.
+func (m *MemoryStorage) GetWithdrawals(ctx context.Context, address string) ([]*model.ETHWithdrawal, error) {
+	return m.withdrawals.get(address), nil
+}
+
+// RemoveBlockWithdrawals remove withdrawals of address included in block hash.
+func (m *MemoryStorage) RemoveBlockWithdrawals(ctx context.Context, address string, number int64, blockHash string) ([]string, error) {
+	return m.withdrawals.removeBlock(address, blockHash), nil
+}
+
+// PutBackfillJob create or replace a backfill job, a copy is stored so callers may keep mutating theirs.
+func (m *MemoryStorage) PutBackfillJob(ctx context.Context, job *model.ETHBackfillJob) error {
+	saved := *job
+	m.jobRWMutex.Lock()
+	m.backfillJobs[job.ID] = &saved
+	m.jobRWMutex.Unlock()
+	return nil
+}
+
+// ListBackfillJobs return all backfill jobs ordered by id.
+func (m *MemoryStorage) ListBackfillJobs(ctx context.Context) ([]*model.ETHBackfillJob, error) {
+	m.jobRWMutex.RLock()
+	jobs := make([]*model.ETHBackfillJob, 0, len(m.backfillJobs))
+	for _, job := range m.backfillJobs {
+		saved := *job
+		jobs = append(jobs, &saved)
+	}
+	m.jobRWMutex.RUnlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+// LoadCursor return the last fully processed block number.
+func (m *MemoryStorage) LoadCursor(ctx context.Context) (int64, bool, error) {
+	return m.cursor.Load(ctx)
+}
+
+// SaveCursor persist the last fully processed block number.
+func (m *MemoryStorage) SaveCursor(ctx context.Context, number int64) error {
+	return m.cursor.Save(ctx, number)
+}
+
+// Close nothing to release.
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+// txKey sortable key of a transaction: 8 bytes block number, 4 bytes transaction index, then hash.
+func txKey(tx *model.ETHTransaction) []byte {
+	number := tx.BlockNumber
+	index := tx.TransactionIndex
+	key := make([]byte, 12, 12+len(tx.Hash))
+	binary.BigEndian.PutUint64(key[:8], uint64(number))
+	binary.BigEndian.PutUint32(key[8:12], uint32(index))
+	return append(key, tx.Hash...)
+}
+
+// txBlock block hash of a transaction and its hash, reported when the block is rolled back.
+func txBlock(tx *model.ETHTransaction) (string, string) {
+	return string(tx.BlockHash), string(tx.Hash)
+}
+
+// transferKey sortable key of a token transfer: 8 bytes block number, 4 bytes log index, 4 bytes batch index.
+// a log index is unique within a block, an ERC-1155 batch log moves several token ids.
+func transferKey(transfer *model.ETHTokenTransfer) []byte {
+	number := transfer.BlockNumber
+	index := transfer.LogIndex
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], uint64(number))
+	binary.BigEndian.PutUint32(key[8:12], uint32(index))
+	binary.BigEndian.PutUint32(key[12:16], uint32(transfer.BatchIndex))
+	return key
+}
+
+// transferBlock block hash of a token transfer and its transaction hash.
+func transferBlock(transfer *model.ETHTokenTransfer) (string, string) {
+	return string(transfer.BlockHash), string(transfer.TransactionHash)
+}
+
+// internalKey sortable key of an internal transfer: 8 bytes block number, 4 bytes transaction index,
+// then 4 bytes per trace address level, so calls sort in call tree order.
+func internalKey(transfer *model.ETHInternalTransfer) []byte {
+	number := transfer.BlockNumber
+	index := transfer.TransactionIndex
+	key := make([]byte, 12+4*len(transfer.TraceAddress))
+	binary.BigEndian.PutUint64(key[:8], uint64(number))
+	binary.BigEndian.PutUint32(key[8:12], uint32(index))
+	for i, position := range transfer.TraceAddress {
+		binary.BigEndian.PutUint32(key[12+4*i:16+4*i], uint32(position))
+	}
+	return key
+}
+
+// internalBlock block hash of an internal transfer and its transaction hash.
+func internalBlock(transfer *model.ETHInternalTransfer) (string, string) {
+	return string(transfer.BlockHash), string(transfer.TransactionHash)
+}
+
+// withdrawalKey sortable key of a withdrawal: 8 bytes block number then 8 bytes withdrawal index.
+func withdrawalKey(withdrawal *model.ETHWithdrawal) []byte {
+	number := withdrawal.BlockNumber
+	index := withdrawal.Index
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], uint64(number))
+	binary.BigEndian.PutUint64(key[8:], uint64(index))
+	return key
+}
+
+// withdrawalBlock block hash of a withdrawal and its index.
+func withdrawalBlock(withdrawal *model.ETHWithdrawal) (string, string) {
+	return string(withdrawal.BlockHash), withdrawal.Index.String()
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// storage backend names, selected by the STORAGE config.
+const (
+	BACKEND_MEMORY = "memory"
+	BACKEND_BOLT   = "bolt"
+)
+
+// ErrInvalidCursor the page cursor was not returned by a previous listing.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Storage persist subscriptions, matched transactions, token and internal transfers, withdrawals, and the ingest cursor.
+type Storage interface {
+	// PutSubscription create or replace a subscription.
+	PutSubscription(ctx context.Context, sub *model.ETHSubscription) error
+	// PutSubscriptions create or replace subscriptions in one batch.
+	PutSubscriptions(ctx context.Context, subs []*model.ETHSubscription) error
+	// ListSubscriptions return all subscriptions.
+	ListSubscriptions(ctx context.Context) ([]*model.ETHSubscription, error)
+	// QuerySubscriptions return up to limit subscriptions ordered by address after cursor, of one owner if owner is not empty,
+	// and the cursor of the next page, empty on the last page.
+	QuerySubscriptions(ctx context.Context, owner, cursor string, limit int) ([]*model.ETHSubscription, string, error)
+	// GetSubscription return the subscription of address, ok is false if not subscribed.
+	GetSubscription(ctx context.Context, address string) (sub *model.ETHSubscription, ok bool, err error)
+	// DeleteSubscription remove the subscription of address,
+	// purge also remove its stored transactions, token and internal transfers and withdrawals.
+	DeleteSubscription(ctx context.Context, address string, purge bool) error
+
+	// AppendBlock store the records of one block in one batch, either all or none of them are stored,
+	// a record already stored for an address is overwritten, not duplicated.
+	AppendBlock(ctx context.Context, batch *BlockBatch) error
+
+	// GetTransactions return transactions of address ordered by block number and transaction index.
+	GetTransactions(ctx context.Context, address string) ([]*model.ETHTransaction, error)
+	// QueryTransactions return a page of transactions of address matching a checked query,
+	// and the cursor of the next page, empty on the last page.
+	QueryTransactions(ctx context.Context, address string, query *model.ETHTxQuery) ([]*model.ETHTransaction, string, error)
+	// RemoveBlockTransactions remove transactions of address included in block hash, return removed tx hashes.
+	RemoveBlockTransactions(ctx context.Context, address string, number int64, blockHash string) ([]string, error)
+
+	// GetTokenTransfers return token transfers of address ordered by block number and log index.
+	GetTokenTransfers(ctx context.Context, address string) ([]*model.ETHTokenTransfer, error)
+	// RemoveBlockTokenTransfers remove token transfers of address included in block hash, return their tx hashes.
+	RemoveBlockTokenTransfers(ctx context.Context, address string, number int64, blockHash string) ([]string, error)
+
+	// GetInternalTransfers return internal transfers of address ordered by block number, transaction index and trace address.
+	GetInternalTransfers(ctx context.Context, address string) ([]*model.ETHInternalTransfer, error)
+	// RemoveBlockInternalTransfers remove internal transfers of address included in block hash, return their tx hashes.
+	RemoveBlockInternalTransfers(ctx context.Context, address string, number int64, blockHash string) ([]string, error)
+
+	// GetWithdrawals return withdrawals of address ordered by block number and withdrawal index.
+	GetWithdrawals(ctx context.Context, address string) ([]*model.ETHWithdrawal, error)
+	// RemoveBlockWithdrawals remove withdrawals of address included in block hash, return their indexes.
+	RemoveBlockWithdrawals(ctx context.Context, address string, number int64, blockHash string) ([]string, error)
+
+	// PutBackfillJob create or replace a backfill job.
+	PutBackfillJob(ctx context.Context, job *model.ETHBackfillJob) error
+	// ListBackfillJobs return all backfill jobs ordered by id.
+	ListBackfillJobs(ctx context.Context) ([]*model.ETHBackfillJob, error)
+
+	// LoadCursor return the last fully processed block number, ok is false if none saved yet.
+	LoadCursor(ctx context.Context) (number int64, ok bool, err error)
+	// SaveCursor persist the last fully processed block number.
+	SaveCursor(ctx context.Context, number int64) error
+
+	// Close release the backend.
+	Close() error
+}
+
+// BlockBatch records of one block per subscribed address.
+type BlockBatch struct {
+	Transactions      map[string][]*model.ETHTransaction
+	TokenTransfers    map[string][]*model.ETHTokenTransfer
+	InternalTransfers map[string][]*model.ETHInternalTransfer
+	Withdrawals       map[string][]*model.ETHWithdrawal
+}
+
+// Empty report whether batch has no record to store.
+func (b *BlockBatch) Empty() bool {
+	return len(b.Transactions) == 0 && len(b.TokenTransfers) == 0 && len(b.InternalTransfers) == 0 && len(b.Withdrawals) == 0
+}
+
+// Config storage configuration.
+type Config struct {
+	Backend    string // memory or bolt.
+	Path       string // bolt database file.
+	CursorFile string // cursor file of the memory backend, empty disable persistence.
+}
+
+// New create the storage backend selected by conf.
+func New(conf *Config) (Storage, error) {
+	switch conf.Backend {
+	case "", BACKEND_MEMORY:
+		return NewMemoryStorage(conf.CursorFile), nil
+	case BACKEND_BOLT:
+		return NewBoltStorage(conf.Path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", conf.Backend)
+	}
+}
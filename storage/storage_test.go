@@ -0,0 +1,385 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/sugarshop/token-gateway/model"
+	"github.com/tj/assert"
+)
+
+func testStorages(t *testing.T) map[string]Storage {
+	bolt, err := NewBoltStorage(filepath.Join(t.TempDir(), "data", "token-gateway.db"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { bolt.Close() })
+	return map[string]Storage{
+		BACKEND_MEMORY: NewMemoryStorage(""),
+		BACKEND_BOLT:   bolt,
+	}
+}
+
+func TestStorage_Transactions(t *testing.T) {
+	ctx := context.Background()
+	addr := "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.AppendBlock(ctx, &BlockBatch{Transactions: map[string][]*model.ETHTransaction{
+				addr: {
+					{Hash: "0x3", BlockHash: "0xb", BlockNumber: 0x11, TransactionIndex: 0x0},
+					{Hash: "0x1", BlockHash: "0xa", BlockNumber: 0x10, TransactionIndex: 0x2},
+				},
+			}})
+			assert.Nil(t, err)
+			// same transaction again, must not duplicate.
+			err = store.AppendBlock(ctx, &BlockBatch{Transactions: map[string][]*model.ETHTransaction{
+				addr: {
+					{Hash: "0x2", BlockHash: "0xa", BlockNumber: 0x10, TransactionIndex: 0xa},
+					{Hash: "0x1", BlockHash: "0xa", BlockNumber: 0x10, TransactionIndex: 0x2},
+				},
+			}})
+			assert.Nil(t, err)
+
+			list, err := store.GetTransactions(ctx, addr)
+			assert.Nil(t, err)
+			hashes := []string{}
+			for _, tx := range list {
+				hashes = append(hashes, string(tx.Hash))
+			}
+			assert.Equal(t, []string{"0x1", "0x2", "0x3"}, hashes)
+
+			removed, err := store.RemoveBlockTransactions(ctx, addr, 0x10, "0xa")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"0x1", "0x2"}, removed)
+			list, err = store.GetTransactions(ctx, addr)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(list))
+		})
+	}
+}
+
+func TestStorage_QueryTransactions(t *testing.T) {
+	ctx := context.Background()
+	const (
+		addr  = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+		other = "0x70997970c51812dc3a010c7d01b50e0d17dc79c8"
+	)
+	txs := make([]*model.ETHTransaction, 0)
+	for i := 0; i < 10; i++ {
+		tx := &model.ETHTransaction{
+			Hash:             model.Hash(fmt.Sprintf("0x%x", i)),
+			BlockHash:        model.Hash(fmt.Sprintf("0xb%x", i/2)),
+			BlockNumber:      model.Uint64(0x10 + i/2),
+			BlockTimestamp:   model.Uint64(1700000000 + 12*(i/2)),
+			TransactionIndex: model.Uint64(i % 2),
+			From:             addr,
+			To:               other,
+			Value:            model.NewWei(big.NewInt(int64(i))),
+			Type:             model.TX_TYPE_DYNAMIC_FEE,
+		}
+		if i%3 == 0 {
+			tx.From, tx.To, tx.Type = other, addr, model.TX_TYPE_LEGACY
+		}
+		txs = append(txs, tx)
+	}
+	txs[9].From = addr
+	hashesOf := func(list []*model.ETHTransaction) []string {
+		hashes := []string{}
+		for _, tx := range list {
+			hashes = append(hashes, string(tx.Hash))
+		}
+		return hashes
+	}
+	legacy := model.TX_TYPE_LEGACY
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, store.AppendBlock(ctx, &BlockBatch{Transactions: map[string][]*model.ETHTransaction{addr: txs}}))
+
+			// walk every page in both orders.
+			for order, want := range map[string][]string{
+				model.ORDER_ASC:  {"0x0", "0x1", "0x2", "0x3", "0x4", "0x5", "0x6", "0x7", "0x8", "0x9"},
+				model.ORDER_DESC: {"0x9", "0x8", "0x7", "0x6", "0x5", "0x4", "0x3", "0x2", "0x1", "0x0"},
+			} {
+				query := &model.ETHTxQuery{Limit: 3, Order: order}
+				hashes, pages := []string{}, 0
+				for {
+					list, next, err := store.QueryTransactions(ctx, addr, query)
+					assert.Nil(t, err)
+					hashes = append(hashes, hashesOf(list)...)
+					pages++
+					if len(next) == 0 {
+						break
+					}
+					query.Cursor = next
+				}
+				assert.Equal(t, want, hashes, order)
+				assert.Equal(t, 4, pages, order)
+			}
+
+			for _, c := range []struct {
+				query *model.ETHTxQuery
+				want  []string
+			}{
+				{&model.ETHTxQuery{Direction: model.TX_DIRECTION_INBOUND}, []string{"0x0", "0x3", "0x6"}},
+				{&model.ETHTxQuery{Direction: model.TX_DIRECTION_OUTBOUND}, []string{"0x1", "0x2", "0x4", "0x5", "0x7", "0x8"}},
+				{&model.ETHTxQuery{Direction: model.TX_DIRECTION_SELF}, []string{"0x9"}},
+				{&model.ETHTxQuery{FromBlock: 0x11, ToBlock: 0x12}, []string{"0x2", "0x3", "0x4", "0x5"}},
+				{&model.ETHTxQuery{FromBlock: 0x11, ToBlock: 0x12, Order: model.ORDER_DESC}, []string{"0x5", "0x4", "0x3", "0x2"}},
+				{&model.ETHTxQuery{FromTime: 1700000036}, []string{"0x6", "0x7", "0x8", "0x9"}},
+				{&model.ETHTxQuery{ToTime: 1700000012}, []string{"0x0", "0x1", "0x2", "0x3"}},
+				{&model.ETHTxQuery{MinValue: big.NewInt(8)}, []string{"0x8", "0x9"}},
+				{&model.ETHTxQuery{Type: &legacy, Order: model.ORDER_DESC}, []string{"0x9", "0x6", "0x3", "0x0"}},
+				{&model.ETHTxQuery{Type: &legacy, MinValue: big.NewInt(1), ToBlock: 0x12}, []string{"0x3"}},
+			} {
+				assert.Nil(t, c.query.Check())
+				list, next, err := store.QueryTransactions(ctx, addr, c.query)
+				assert.Nil(t, err)
+				assert.Equal(t, c.want, hashesOf(list), fmt.Sprintf("%+v", c.query))
+				assert.Equal(t, "", next)
+			}
+
+			// a cursor of a removed transaction still resumes from its position.
+			query := &model.ETHTxQuery{Limit: 2, Order: model.ORDER_DESC}
+			_, next, err := store.QueryTransactions(ctx, addr, query)
+			assert.Nil(t, err)
+			_, err = store.RemoveBlockTransactions(ctx, addr, 0x14, "0xb4")
+			assert.Nil(t, err)
+			query.Cursor = next
+			list, _, err := store.QueryTransactions(ctx, addr, query)
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"0x7", "0x6"}, hashesOf(list))
+
+			_, _, err = store.QueryTransactions(ctx, addr, &model.ETHTxQuery{Limit: 1, Cursor: "!"})
+			assert.Equal(t, ErrInvalidCursor, err)
+			list, next, err = store.QueryTransactions(ctx, other, &model.ETHTxQuery{Limit: 1})
+			assert.Nil(t, err)
+			assert.Equal(t, 0, len(list))
+			assert.Equal(t, "", next)
+		})
+	}
+}
+
+func TestStorage_SubscriptionsAndCursor(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, store.PutSubscription(ctx, &model.ETHSubscription{Address: "0xb", CreatedAt: 2}))
+			assert.Nil(t, store.PutSubscription(ctx, &model.ETHSubscription{Address: "0xa", CreatedAt: 1}))
+			subs, err := store.ListSubscriptions(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, 2, len(subs))
+			assert.Equal(t, model.Address("0xa"), subs[0].Address)
+
+			_, ok, err := store.LoadCursor(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, false, ok)
+			assert.Nil(t, store.SaveCursor(ctx, 19862630))
+			if name == BACKEND_MEMORY {
+				// memory backend without cursor file does not persist.
+				return
+			}
+			num, ok, err := store.LoadCursor(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, int64(19862630), num)
+		})
+	}
+}
+
+func TestStorage_DeleteSubscription(t *testing.T) {
+	ctx := context.Background()
+	const addr = "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			_, ok, err := store.GetSubscription(ctx, addr)
+			assert.Nil(t, err)
+			assert.False(t, ok)
+			// deleting an unknown address is not an error.
+			assert.Nil(t, store.DeleteSubscription(ctx, addr, true))
+
+			for _, purge := range []bool{false, true} {
+				assert.Nil(t, store.PutSubscription(ctx, &model.ETHSubscription{Address: addr, CreatedAt: 1, Label: "hot wallet", Owner: "payments"}))
+				sub, ok, err := store.GetSubscription(ctx, addr)
+				assert.Nil(t, err)
+				assert.True(t, ok)
+				assert.Equal(t, "hot wallet", sub.Label)
+				assert.Equal(t, "payments", sub.Owner)
+				assert.Nil(t, store.AppendBlock(ctx, &BlockBatch{Transactions: map[string][]*model.ETHTransaction{addr: {{Hash: "0x1", BlockHash: "0xa", BlockNumber: 0x10}}}}))
+				assert.Nil(t, store.AppendBlock(ctx, &BlockBatch{Withdrawals: map[string][]*model.ETHWithdrawal{addr: {{Index: 1, Address: addr, BlockHash: "0xa", BlockNumber: 0x10}}}}))
+
+				assert.Nil(t, store.DeleteSubscription(ctx, addr, purge))
+				_, ok, err = store.GetSubscription(ctx, addr)
+				assert.Nil(t, err)
+				assert.False(t, ok)
+				txs, err := store.GetTransactions(ctx, addr)
+				assert.Nil(t, err)
+				withdrawals, err := store.GetWithdrawals(ctx, addr)
+				assert.Nil(t, err)
+				if purge {
+					assert.Equal(t, 0, len(txs))
+					assert.Equal(t, 0, len(withdrawals))
+				} else {
+					assert.Equal(t, 1, len(txs))
+					assert.Equal(t, 1, len(withdrawals))
+				}
+			}
+		})
+	}
+}
+
+func TestStorage_QuerySubscriptions(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, sub := range []*model.ETHSubscription{{Address: "0xc", Owner: "acme"}, {Address: "0xa", Owner: "acme"}, {Address: "0xb"}, {Address: "0xd", Owner: "acme"}} {
+				assert.Nil(t, store.PutSubscription(ctx, sub))
+			}
+			assert.Nil(t, store.DeleteSubscription(ctx, "0xd", false))
+			subs, next, err := store.QuerySubscriptions(ctx, "", "", 2)
+			assert.Nil(t, err)
+			assert.Equal(t, 2, len(subs))
+			assert.Equal(t, model.Address("0xb"), subs[1].Address)
+			assert.Equal(t, "0xb", next)
+			subs, next, err = store.QuerySubscriptions(ctx, "", next, 2)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(subs))
+			assert.Equal(t, model.Address("0xc"), subs[0].Address)
+			assert.Equal(t, "", next)
+			// owner pages skip other owners.
+			subs, next, err = store.QuerySubscriptions(ctx, "acme", "0xa", 1)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(subs))
+			assert.Equal(t, model.Address("0xc"), subs[0].Address)
+			assert.Equal(t, "", next)
+		})
+	}
+}
+
+func TestStorage_BackfillJobs(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			job := &model.ETHBackfillJob{ID: "1", Address: "0xa", FromBlock: 10, ToBlock: 20, CurrentBlock: 9, Status: model.BACKFILL_STATUS_RUNNING}
+			assert.Nil(t, store.PutBackfillJob(ctx, job))
+			job.CurrentBlock = 15
+			assert.Nil(t, store.PutBackfillJob(ctx, job))
+			jobs, err := store.ListBackfillJobs(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(jobs))
+			assert.Equal(t, int64(15), jobs[0].CurrentBlock)
+		})
+	}
+}
+
+func TestStorage_TokenTransfers(t *testing.T) {
+	ctx := context.Background()
+	addr := "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.AppendBlock(ctx, &BlockBatch{TokenTransfers: map[string][]*model.ETHTokenTransfer{
+				addr: {
+					{TransactionHash: "0x3", BlockHash: "0xb", BlockNumber: 0x11, LogIndex: 0x0},
+					{TransactionHash: "0x1", BlockHash: "0xa", BlockNumber: 0x10, LogIndex: 0x2},
+				},
+			}})
+			assert.Nil(t, err)
+			// same log again, must not duplicate.
+			err = store.AppendBlock(ctx, &BlockBatch{TokenTransfers: map[string][]*model.ETHTokenTransfer{
+				addr: {
+					{TransactionHash: "0x2", BlockHash: "0xa", BlockNumber: 0x10, LogIndex: 0xa},
+					{TransactionHash: "0x1", BlockHash: "0xa", BlockNumber: 0x10, LogIndex: 0x2},
+				},
+			}})
+			assert.Nil(t, err)
+
+			list, err := store.GetTokenTransfers(ctx, addr)
+			assert.Nil(t, err)
+			hashes := []string{}
+			for _, transfer := range list {
+				hashes = append(hashes, string(transfer.TransactionHash))
+			}
+			assert.Equal(t, []string{"0x1", "0x2", "0x3"}, hashes)
+
+			removed, err := store.RemoveBlockTokenTransfers(ctx, addr, 0x10, "0xa")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"0x1", "0x2"}, removed)
+			list, err = store.GetTokenTransfers(ctx, addr)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(list))
+		})
+	}
+}
+
+func TestStorage_InternalTransfers(t *testing.T) {
+	ctx := context.Background()
+	addr := "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.AppendBlock(ctx, &BlockBatch{InternalTransfers: map[string][]*model.ETHInternalTransfer{
+				addr: {
+					{TransactionHash: "0x3", BlockHash: "0xb", BlockNumber: 0x11, TransactionIndex: 0x0, TraceAddress: []int{0}},
+					{TransactionHash: "0x1", BlockHash: "0xa", BlockNumber: 0x10, TransactionIndex: 0x2, TraceAddress: []int{1, 0}},
+					{TransactionHash: "0x1", BlockHash: "0xa", BlockNumber: 0x10, TransactionIndex: 0x2, TraceAddress: []int{1}},
+				},
+			}})
+			assert.Nil(t, err)
+			// same call again, must not duplicate.
+			err = store.AppendBlock(ctx, &BlockBatch{InternalTransfers: map[string][]*model.ETHInternalTransfer{
+				addr: {{TransactionHash: "0x1", BlockHash: "0xa", BlockNumber: 0x10, TransactionIndex: 0x2, TraceAddress: []int{1}}},
+			}})
+			assert.Nil(t, err)
+
+			list, err := store.GetInternalTransfers(ctx, addr)
+			assert.Nil(t, err)
+			assert.Equal(t, 3, len(list))
+			assert.Equal(t, []int{1}, list[0].TraceAddress)
+			assert.Equal(t, []int{1, 0}, list[1].TraceAddress)
+			assert.Equal(t, model.Hash("0x3"), list[2].TransactionHash)
+
+			removed, err := store.RemoveBlockInternalTransfers(ctx, addr, 0x10, "0xa")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"0x1", "0x1"}, removed)
+			list, err = store.GetInternalTransfers(ctx, addr)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(list))
+		})
+	}
+}
+
+func TestStorage_Withdrawals(t *testing.T) {
+	ctx := context.Background()
+	addr := "0xae2fc483527b8ef99eb5d9b44875f005ba1fae13"
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			err := store.AppendBlock(ctx, &BlockBatch{Withdrawals: map[string][]*model.ETHWithdrawal{
+				addr: {
+					{Index: 0x20, BlockHash: "0xb", BlockNumber: 0x11},
+					{Index: 0x11, BlockHash: "0xa", BlockNumber: 0x10},
+					{Index: 0x10, BlockHash: "0xa", BlockNumber: 0x10},
+				},
+			}})
+			assert.Nil(t, err)
+			// same withdrawal again, must not duplicate.
+			err = store.AppendBlock(ctx, &BlockBatch{Withdrawals: map[string][]*model.ETHWithdrawal{
+				addr: {{Index: 0x10, BlockHash: "0xa", BlockNumber: 0x10}},
+			}})
+			assert.Nil(t, err)
+
+			list, err := store.GetWithdrawals(ctx, addr)
+			assert.Nil(t, err)
+			assert.Equal(t, 3, len(list))
+			assert.Equal(t, model.Uint64(0x10), list[0].Index)
+			assert.Equal(t, model.Uint64(0x11), list[1].Index)
+			assert.Equal(t, model.Uint64(0x20), list[2].Index)
+
+			removed, err := store.RemoveBlockWithdrawals(ctx, addr, 0x10, "0xa")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"0x10", "0x11"}, removed)
+			list, err = store.GetWithdrawals(ctx, addr)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(list))
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"encoding/base64"
+
+	"github.com/sugarshop/token-gateway/model"
+)
+
+// txPage collect one page of a transaction listing, fed in listing order.
+type txPage struct {
+	address string
+	query   *model.ETHTxQuery
+	list    []*model.ETHTransaction
+	next    string
+}
+
+func newTxPage(address string, query *model.ETHTxQuery) *txPage {
+	return &txPage{address: address, query: query, list: make([]*model.ETHTransaction, 0)}
+}
+
+// add append tx if it matches the query, return false once no further transaction can be added.
+func (p *txPage) add(tx *model.ETHTransaction) bool {
+	number := uint64(tx.BlockNumber)
+	// past the block range in listing order, nothing further can match.
+	if p.query.Order == model.ORDER_DESC && number < p.query.FromBlock {
+		return false
+	}
+	if p.query.Order != model.ORDER_DESC && p.query.ToBlock > 0 && number > p.query.ToBlock {
+		return false
+	}
+	if !p.query.Match(p.address, tx) {
+		return true
+	}
+	if len(p.list) == p.query.Limit {
+		// a further match exists, the next page starts after the last transaction of this one.
+		p.next = encodeTxCursor(txKey(p.list[len(p.list)-1]))
+		return false
+	}
+	p.list = append(p.list, tx)
+	return true
+}
+
+// TxCursor cursor of tx, a listing from it continues after tx in every address of tx.
+func TxCursor(tx *model.ETHTransaction) string {
+	return encodeTxCursor(txKey(tx))
+}
+
+// encodeTxCursor opaque cursor of a transaction key.
+func encodeTxCursor(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// decodeTxCursor transaction key of a cursor, nil for an empty cursor.
+func decodeTxCursor(cursor string) ([]byte, error) {
+	if len(cursor) == 0 {
+		return nil, nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) < 12 {
+		return nil, ErrInvalidCursor
+	}
+	return key, nil
+}
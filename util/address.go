@@ -0,0 +1,63 @@
+package util
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	// ErrInvalidAddress the address is not 0x followed by 40 hexadecimal digits.
+	ErrInvalidAddress = errors.New("invalid address, want 0x followed by 40 hex digits")
+	// ErrAddressChecksum the mixed-case address does not match its EIP-55 checksum.
+	ErrAddressChecksum = errors.New("invalid address EIP-55 checksum")
+)
+
+// IsHexAddress report whether s is a 0x prefixed 20 bytes hexadecimal address, of any letter case.
+func IsHexAddress(s string) bool {
+	if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	for _, c := range s[2:] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAddress validate a hex address and return it lowercased,
+// a mixed-case address must match its EIP-55 checksum, an all lower or all upper case one carries none.
+func ParseAddress(s string) (string, error) {
+	if !IsHexAddress(s) {
+		return "", ErrInvalidAddress
+	}
+	lower := strings.ToLower(s)
+	if s != lower && s[2:] != strings.ToUpper(s[2:]) && s != ChecksumAddress(lower) {
+		return "", ErrAddressChecksum
+	}
+	return lower, nil
+}
+
+// ChecksumAddress EIP-55 mixed-case form of a hex address, s is returned unchanged if it is not one.
+func ChecksumAddress(s string) string {
+	if !IsHexAddress(s) {
+		return s
+	}
+	digits := []byte(strings.ToLower(s[2:]))
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(digits)
+	sum := hash.Sum(nil)
+	for i, c := range digits {
+		// a letter is upper-cased if the matching nibble of the hash is 8 or more.
+		nibble := sum[i/2] >> 4
+		if i%2 == 1 {
+			nibble = sum[i/2] & 0xf
+		}
+		if c >= 'a' && nibble >= 8 {
+			digits[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(digits)
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestChecksumAddress(t *testing.T) {
+	// EIP-55 test vectors.
+	for _, want := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		assert.Equal(t, want, ChecksumAddress(want))
+		assert.Equal(t, want, ChecksumAddress(strings.ToLower(want)))
+	}
+	assert.Equal(t, "0x1", ChecksumAddress("0x1"))
+}
+
+func TestParseAddress(t *testing.T) {
+	const lower = "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"
+	for _, s := range []string{lower, "0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"} {
+		address, err := ParseAddress(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, lower, address)
+	}
+	_, err := ParseAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD")
+	assert.Equal(t, ErrAddressChecksum, err)
+	for _, s := range []string{"", "5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beae", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaeg"} {
+		_, err := ParseAddress(s)
+		assert.Equal(t, ErrInvalidAddress, err, s)
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sugarshop/env"
+)
+
+// EnvString return string config value of key, def if not set.
+func EnvString(key string, def string) string {
+	val, ok := env.GlobalEnv().Get(key)
+	if !ok || len(val) == 0 {
+		return def
+	}
+	return val
+}
+
+// EnvInt64 return integer config value of key, def if not set or malformed.
+func EnvInt64(key string, def int64) int64 {
+	val, ok := env.GlobalEnv().Get(key)
+	if !ok || len(val) == 0 {
+		return def
+	}
+	num, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return def
+	}
+	return num
+}
+
+// EnvBool return boolean config value of key, def if not set or malformed.
+func EnvBool(key string, def bool) bool {
+	val, ok := env.GlobalEnv().Get(key)
+	if !ok || len(val) == 0 {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// EnvDuration return duration config value of key such as "500ms", def if not set or malformed.
+func EnvDuration(key string, def time.Duration) time.Duration {
+	val, ok := env.GlobalEnv().Get(key)
+	if !ok || len(val) == 0 {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,15 @@
+package util
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ParseHexInt64 convert a 0x prefixed hexadecimal quantity to int64.
+func ParseHexInt64(hexStr string) (int64, error) {
+	if !strings.HasPrefix(hexStr, "0x") && !strings.HasPrefix(hexStr, "0X") {
+		return 0, errors.New("hex quantity without 0x prefix")
+	}
+	return strconv.ParseInt(hexStr[2:], 16, 64)
+}